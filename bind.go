@@ -4,28 +4,98 @@ package wgortc
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/pion/ice/v2"
+	"github.com/pion/transport/v2"
 	"github.com/pion/webrtc/v3"
 	"github.com/shynome/wgortc/endpoint"
 	"github.com/shynome/wgortc/mux"
 	"github.com/shynome/wgortc/signaler"
 	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
 )
 
 type Bind struct {
 	NewSettingEngine func() webrtc.SettingEngine
 
 	signaler.Channel
+	// Net replaces the network stack, such as pion vnet, udp mux is disabled then
+	Net transport.Net
+	// Signalers are extra named signalers, which could be selected by endpoint uri `webrtc://name?signaler=ws`
+	Signalers map[string]signaler.Channel
 
-	api *webrtc.API
-	mux ice.UDPMux
+	api           *webrtc.API
+	settingEngine webrtc.SettingEngine
+	mux           ice.UDPMux
 
 	ICEServers []webrtc.ICEServer
+	// ICEServerProvider is consulted per connection, its servers are appended to ICEServers
+	ICEServerProvider ICEServerProvider
+	iceCache          iceServerCache
+
+	// ICETransportPolicy relay can't be loosened by endpoint
+	ICETransportPolicy webrtc.ICETransportPolicy
+	// CandidateTypes limits the local candidates, endpoint could override it by `candidates=host`
+	CandidateTypes []webrtc.ICECandidateType
+	// NetworkTypes limits the local candidates network, endpoint could override it by `network=udp4`
+	NetworkTypes []webrtc.NetworkType
+
+	// Reliability of data DataChannels of outbound peers, endpoint could override it by `reliability=partial&lifetime=200ms`
+	Reliability endpoint.Reliability
+	// Lifetime is the retransmit window of endpoint.ReliabilityPartial
+	Lifetime time.Duration
+
+	// Channels is the count of DataChannels packets are striped over, endpoint could override it by `channels=4`
+	Channels int
+
+	// LinkMTU is the mtu of the network path, endpoint could override it by `mtu=1280`
+	LinkMTU int
+	// Fragment splits packets larger than the path mtu, endpoint could enable it by `fragment=true`
+	Fragment bool
+
+	// Transport carries packets of outbound peers over DataChannels or RTP, endpoint could override it by `transport=rtp`.
+	// inbound sessions follow the offer
+	Transport endpoint.Transport
+
+	// Padding hides packet sizes, endpoint could override it by `padding=bucket`
+	Padding endpoint.Padding
+	// Cover is the interval of cover traffic, endpoint could override it by `cover=50ms`
+	Cover time.Duration
+
+	// Certificate is the long-lived dtls certificate, peers could pin its fingerprint by `fingerprint=sha-256:...`.
+	// nil means a fresh certificate per connection, see LoadCertificate
+	Certificate *webrtc.Certificate
+
+	// PrivateKey is the wireguard private key of the device, setting it binds the dtls identity to the wireguard key:
+	// offers and answers carry a tag of the dtls fingerprint keyed by the static-static shared secret,
+	// outbound endpoints need `pubkey=` and inbound peers must be one of TrustedKeys
+	PrivateKey  endpoint.Key
+	TrustedKeys []endpoint.Key
+
+	// Timeouts of the handshake, zero fields mean endpoint.DefaultTimeouts
+	Timeouts endpoint.Timeouts
+	// MaxInbounds limits the concurrent inbound sessions, zero means unlimited
+	MaxInbounds int
+	// Logger logs the failed inbound sessions, nil means silent
+	Logger *device.Logger
+
+	// Capabilities are advertised to peers, nil means endpoint.DefaultCapabilities
+	Capabilities []endpoint.Capability
+
+	// errs buffers the asynchronous failures of endpoints, see Errors
+	errs chan error
 
 	msgCh chan packetMsg
+	// done is closed by Close, senders stop sending to msgCh then
+	done chan struct{}
+
+	peers    map[peerKey]conn.Endpoint
+	inbounds map[*endpoint.Inbound]struct{}
 
 	closed bool
 	locker *sync.RWMutex
@@ -37,35 +107,62 @@ func NewBind(signaler signaler.Channel) *Bind {
 	return &Bind{
 		Channel: signaler,
 
+		peers:    make(map[peerKey]conn.Endpoint),
+		inbounds: make(map[*endpoint.Inbound]struct{}),
+		errs:     make(chan error, ErrorsBuffer),
+
 		closed: false,
 		locker: &sync.RWMutex{},
 	}
 }
 
+type peerKey struct {
+	signaler string
+	id       string
+}
+
 func (b *Bind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, ierr error) {
 	b.locker.Lock()
 	defer b.locker.Unlock()
 
+	ierr = b.Validate()
+
 	fns = append(fns, b.receiveFunc)
 
 	b.msgCh = make(chan packetMsg, b.BatchSize()-1)
+	b.done = make(chan struct{})
 
 	settingEngine := webrtc.SettingEngine{}
 	if b.NewSettingEngine != nil {
 		settingEngine = b.NewSettingEngine()
 	}
-	if mux.WithUDPMux != nil {
+	if b.Net != nil {
+		settingEngine.SetNet(b.Net)
+	} else if mux.WithUDPMux != nil {
 		b.mux, ierr = mux.WithUDPMux(&settingEngine, &port)
 		actualPort = port
 	}
-	b.api = webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
-
-	ch, ierr := b.Accept()
-	go func() {
-		for ev := range ch {
-			go b.handleConnect(ev)
+	if len(b.NetworkTypes) != 0 {
+		settingEngine.SetNetworkTypes(b.NetworkTypes)
+	}
+	settingEngine.SetReceiveMTU(endpoint.RTPReceiveMTU)
+	b.settingEngine = settingEngine
+	b.api, ierr = b.newAPI(settingEngine)
+
+	for name, s := range b.signalers() {
+		var ch <-chan signaler.Session
+		ch, ierr = s.Accept()
+		go func(ch <-chan signaler.Session) {
+			for ev := range ch {
+				go b.handleConnect(ev)
+			}
+		}(ch)
+		if r, ok := s.(signaler.Relay); ok {
+			var rch <-chan signaler.Packet
+			rch, ierr = r.Relayed()
+			go b.relayed(name, r, rch)
 		}
-	}()
+	}
 
 	b.closed = false
 	return
@@ -81,8 +178,10 @@ func (b *Bind) receiveFunc(packets [][]byte, sizes []int, eps []conn.Endpoint) (
 		return 0, net.ErrClosed
 	}
 	for i := 0; i < b.BatchSize(); i++ {
-		msg, ok := <-b.msgCh
-		if !ok {
+		var msg packetMsg
+		select {
+		case msg = <-b.msgCh:
+		case <-b.done:
 			return 0, net.ErrClosed
 		}
 		sizes[i] = copy(packets[i], msg.data)
@@ -92,35 +191,96 @@ func (b *Bind) receiveFunc(packets [][]byte, sizes []int, eps []conn.Endpoint) (
 	return
 }
 
-func (b *Bind) handleConnect(sess signaler.Session) {
-	var ierr error
-	_ = ierr
+var ErrTooManyInbounds = errors.New("too many inbound sessions")
 
-	config := webrtc.Configuration{
-		ICEServers: b.ICEServers,
-	}
-	pc, ierr := b.api.NewPeerConnection(config)
+func (b *Bind) handleConnect(sess signaler.Session) (ierr error) {
+	defer func() {
+		if ierr != nil {
+			err := endpoint.NewError(endpoint.PhaseSetup, "", ierr)
+			b.logf("reject inbound session: %v", err)
+			b.report(err)
+			sess.Reject(err)
+			ierr = err
+		}
+	}()
+
+	opts := b.endpointOptions(endpoint.Options{})
+	pc, ierr := b.NewPeerConnection(opts)
 	defer pc.Close()
 
 	inbound := endpoint.NewInbound(sess, pc)
+	inbound.Options = opts
 	initiator, ierr := inbound.ExtractInitiator()
-	b.msgCh <- packetMsg{
-		data: initiator,
-		ep:   inbound,
+
+	b.locker.Lock()
+	if b.MaxInbounds > 0 && len(b.inbounds) >= b.MaxInbounds {
+		b.locker.Unlock()
+		// others may leave soon
+		return &endpoint.Error{Phase: endpoint.PhaseSetup, Err: ErrTooManyInbounds, Temporary: true}
+	}
+	b.inbounds[inbound] = struct{}{}
+	b.locker.Unlock()
+	defer func() {
+		b.locker.Lock()
+		delete(b.inbounds, inbound)
+		b.locker.Unlock()
+	}()
+
+	timer := time.NewTimer(opts.Timeouts.Answer)
+	defer timer.Stop()
+
+	if !b.deliver(packetMsg{data: initiator, ep: inbound}) {
+		return
 	}
 
 	ch := inbound.Message()
-	for d := range ch {
-		if b.isClosed() {
-			break
+	for {
+		select {
+		case d := <-ch:
+			if !b.deliver(packetMsg{data: d, ep: inbound}) {
+				return
+			}
+		case <-timer.C:
+			if pc.ConnectionState() == webrtc.PeerConnectionStateNew {
+				return &endpoint.TimeoutError{Phase: endpoint.PhaseAnswer, After: opts.Timeouts.Answer}
+			}
+		case <-inbound.Done():
+			return
 		}
-		b.msgCh <- packetMsg{
-			data: d,
-			ep:   inbound,
+	}
+}
+
+func (b *Bind) relayed(name string, r signaler.Relay, ch <-chan signaler.Packet) {
+	for p := range ch {
+		if !b.deliver(packetMsg{data: p.Data, ep: b.relayedEndpoint(name, r, p.From)}) {
+			break
 		}
 	}
+}
 
-	return
+// deliver queues msg for receiveFunc, it returns false once the Bind is closed
+func (b *Bind) deliver(msg packetMsg) bool {
+	b.locker.RLock()
+	msgCh, done := b.msgCh, b.done
+	b.locker.RUnlock()
+	select {
+	case msgCh <- msg:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (b *Bind) relayedEndpoint(name string, r signaler.Relay, from string) conn.Endpoint {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	k := peerKey{signaler: name, id: from}
+	if ep, ok := b.peers[k]; ok {
+		return ep
+	}
+	ep := endpoint.NewRelayed(from, r)
+	b.peers[k] = ep
+	return ep
 }
 
 func (b *Bind) isClosed() bool {
@@ -134,32 +294,51 @@ func (b *Bind) Close() (ierr error) {
 	b.locker.Lock()
 	defer b.locker.Unlock()
 
+	if b.done != nil && !b.closed {
+		close(b.done)
+	}
 	b.closed = true
 
 	if b.mux != nil {
 		ierr = b.mux.Close()
 	}
-	if b.Channel != nil {
-		ierr = b.Channel.Close()
+	for _, s := range b.signalers() {
+		ierr = s.Close()
+	}
+	// the remote peers notice the closed peer connections and reconnect
+	for _, ep := range b.peers {
+		if c, ok := ep.(io.Closer); ok {
+			c.Close()
+		}
 	}
-	if b.msgCh != nil {
-		close(b.msgCh)
+	for ep := range b.inbounds {
+		ep.Close()
 	}
 	return
 }
 
 func (b *Bind) ParseEndpoint(s string) (ep conn.Endpoint, err error) {
-	outbound := endpoint.NewOutbound(s, b)
+	id, opts, err := endpoint.ParseURI(s)
+	if err != nil {
+		return
+	}
+	if _, err = b.Signaler(opts.Signaler); err != nil {
+		return
+	}
+	if !b.PrivateKey.IsZero() && opts.PeerKey.IsZero() {
+		return nil, fmt.Errorf("%w: %s", endpoint.ErrPeerKeyRequired, s)
+	}
+	outbound := endpoint.NewOutbound(id, b)
+	outbound.Options = b.endpointOptions(opts)
+	b.locker.Lock()
+	b.peers[peerKey{signaler: opts.Signaler, id: id}] = outbound
+	b.locker.Unlock()
 	go func() {
 		ch := outbound.Message()
 		for d := range ch {
-			if b.isClosed() {
+			if !b.deliver(packetMsg{data: d, ep: outbound}) {
 				break
 			}
-			b.msgCh <- packetMsg{
-				data: d,
-				ep:   outbound,
-			}
 		}
 	}()
 	return outbound, nil
@@ -167,11 +346,116 @@ func (b *Bind) ParseEndpoint(s string) (ep conn.Endpoint, err error) {
 
 var _ endpoint.Hub = (*Bind)(nil)
 
-func (b *Bind) NewPeerConnection() (*webrtc.PeerConnection, error) {
+// endpointOptions fills the endpoint options with Bind settings,
+// options set by the endpoint uri are kept even if they are zero values
+func (b *Bind) endpointOptions(opts endpoint.Options) endpoint.Options {
+	if b.ICETransportPolicy == webrtc.ICETransportPolicyRelay {
+		opts.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	if len(opts.CandidateTypes) == 0 {
+		opts.CandidateTypes = b.CandidateTypes
+	}
+	if opts.Channels == 0 {
+		opts.Channels = b.Channels
+	}
+	if !opts.IsSet("reliability") {
+		opts.Reliability = b.Reliability
+	}
+	if !opts.IsSet("lifetime") {
+		opts.Lifetime = b.Lifetime
+	}
+	if opts.LinkMTU == 0 {
+		opts.LinkMTU = b.LinkMTU
+	}
+	if !opts.IsSet("fragment") {
+		opts.Fragment = b.Fragment
+	}
+	if !opts.IsSet("transport") {
+		opts.Transport = b.Transport
+	}
+	if !opts.IsSet("padding") {
+		opts.Padding = b.Padding
+	}
+	if opts.Cover == 0 {
+		opts.Cover = b.Cover
+	}
+	opts.Capabilities = b.Capabilities
+	if opts.Capabilities == nil {
+		opts.Capabilities = endpoint.DefaultCapabilities
+	}
+	opts.PrivateKey, opts.TrustedKeys = b.PrivateKey, b.TrustedKeys
+	opts.Timeouts = b.Timeouts.WithDefaults()
+	opts.OnError = func(err error) {
+		b.logf("endpoint failed: %v", err)
+		b.report(err)
+	}
+	if !b.PrivateKey.IsZero() {
+		opts.Capabilities = append(opts.Capabilities[:len(opts.Capabilities):len(opts.Capabilities)], endpoint.CapabilityIdentity)
+	}
+	return opts
+}
+
+func (b *Bind) NewPeerConnection(opts endpoint.Options) (pc *webrtc.PeerConnection, err error) {
 	config := webrtc.Configuration{
-		ICEServers: b.ICEServers,
+		ICEServers:         opts.ICEServers,
+		ICETransportPolicy: opts.ICETransportPolicy,
+	}
+	if b.Certificate != nil {
+		config.Certificates = []webrtc.Certificate{*b.Certificate}
+	}
+	if len(config.ICEServers) == 0 {
+		if config.ICEServers, err = b.iceServers(); err != nil {
+			return
+		}
+	}
+	config.ICEServers = endpoint.FilterICEServers(config.ICEServers, opts.CandidateTypes)
+	if endpoint.RelayOnly(opts.CandidateTypes) {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	api := b.api
+	if len(opts.NetworkTypes) != 0 {
+		settingEngine := b.settingEngine
+		settingEngine.SetNetworkTypes(opts.NetworkTypes)
+		if api, err = b.newAPI(settingEngine); err != nil {
+			return
+		}
+	}
+	return api.NewPeerConnection(config)
+}
+
+// newAPI registers the default codecs for endpoint.TransportRTP
+func (b *Bind) newAPI(settingEngine webrtc.SettingEngine) (api *webrtc.API, err error) {
+	m := &webrtc.MediaEngine{}
+	if err = m.RegisterDefaultCodecs(); err != nil {
+		return
+	}
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine), webrtc.WithMediaEngine(m)), nil
+}
+
+// Signaler returns the named signaler, empty name is the default one which may be unset
+func (b *Bind) Signaler(name string) (signaler.Channel, error) {
+	if s := b.signalers()[name]; s != nil {
+		return s, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: no default signaler", ErrSignalerNotFound)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSignalerNotFound, name)
+}
+
+var ErrSignalerNotFound = errors.New("signaler is not found")
+
+func (b *Bind) signalers() map[string]signaler.Channel {
+	ss := make(map[string]signaler.Channel, len(b.Signalers)+1)
+	for name, s := range b.Signalers {
+		if s != nil {
+			ss[name] = s
+		}
+	}
+	if b.Channel != nil {
+		ss[""] = b.Channel
 	}
-	return b.api.NewPeerConnection(config)
+	return ss
 }
 
 func (b *Bind) Send(bufs [][]byte, ep conn.Endpoint) (err error) {
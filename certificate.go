@@ -0,0 +1,71 @@
+package wgortc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// CertificateLifetime is the validity of certificate generated by LoadCertificate
+const CertificateLifetime = 10 * 365 * 24 * time.Hour
+
+var ErrCertificateExpired = errors.New("dtls certificate is expired")
+
+// LoadCertificate loads the pem encoded dtls certificate from path,
+// a new one is generated and saved there if the file doesn't exist.
+// the certificate is kept over restarts, so peers could pin its fingerprint
+func LoadCertificate(path string) (cert *webrtc.Certificate, err error) {
+	pem, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if cert, err = GenerateCertificate(); err != nil {
+			return
+		}
+		var s string
+		if s, err = cert.PEM(); err != nil {
+			return
+		}
+		return cert, os.WriteFile(path, []byte(s), 0o600)
+	}
+	if err != nil {
+		return
+	}
+	if cert, err = webrtc.CertificateFromPEM(string(pem)); err != nil {
+		return nil, fmt.Errorf("load certificate %s: %w", path, err)
+	}
+	if cert.Expires().Before(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrCertificateExpired, path)
+	}
+	return
+}
+
+// GenerateCertificate generates an ecdsa certificate valid for CertificateLifetime,
+// webrtc.GenerateCertificate expires in a month which is too short to pin
+func GenerateCertificate() (*webrtc.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return webrtc.NewCertificate(key, x509.Certificate{
+		Issuer:       pkix.Name{CommonName: "wgortc"},
+		Subject:      pkix.Name{CommonName: "wgortc"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(CertificateLifetime),
+		SerialNumber: serial,
+		Version:      2,
+	})
+}
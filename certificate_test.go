@@ -0,0 +1,27 @@
+package wgortc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+)
+
+func TestLoadCertificate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	cert := try.To1(LoadCertificate(path))
+	assert.That(cert.Expires().After(time.Now().Add(CertificateLifetime - time.Hour)))
+	info := try.To1(os.Stat(path))
+	assert.Equal(info.Mode().Perm(), os.FileMode(0o600))
+
+	// the same certificate is loaded again
+	cert2 := try.To1(LoadCertificate(path))
+	assert.DeepEqual(try.To1(cert2.GetFingerprints()), try.To1(cert.GetFingerprints()))
+
+	try.To(os.WriteFile(path, []byte("invalid"), 0o600))
+	_, err := LoadCertificate(path)
+	assert.Error(err)
+}
@@ -1,90 +1,420 @@
 package endpoint_test
 
 import (
-	"io"
+	"errors"
+	"fmt"
 	"log"
 	"net"
-	"net/http"
-	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/lainio/err2/assert"
 	"github.com/lainio/err2/try"
 	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/signaler"
 	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/conn"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/tun/netstack"
 )
 
-var hub = local.NewHub()
-
-var loglevel = device.LogLevelVerbose
+func init() { testutil.LogLevel = device.LogLevelVerbose }
 
 func TestNet(t *testing.T) {
-	dev := startServer()
+	hub := local.NewHub()
+	dev := startServer(newBind(hub, "server"))
+	defer dev.Close()
+	dev2, tnet := startClient(newBind(hub, "client"), "server")
+	defer dev2.Close()
+
+	httpGet(tnet)
+}
+
+// ice can't connect without candidates, packets should be relayed through signaler
+func TestRelayFallback(t *testing.T) {
+	hub := local.NewHub()
+	dev := startServer(newBind(hub, "server"))
+	defer dev.Close()
+	dev2, tnet := startClient(newBind(hub, "client"), "webrtc://server?relay=force")
+	defer dev2.Close()
+
+	httpGet(tnet)
+}
+
+func TestHostOnly(t *testing.T) {
+	hub := local.NewHub()
+	dev := startServer(newBind(hub, "server"))
+	defer dev.Close()
+	dev2, tnet := startClient(newBind(hub, "client"), "webrtc://server?candidates=host&network=udp4")
+	defer dev2.Close()
+
+	httpGet(tnet)
+}
+
+// peers of different versions advertise different capabilities
+func TestCapabilities(t *testing.T) {
+	cases := []struct {
+		server, client, agreed []endpoint.Capability
+	}{
+		{server: []endpoint.Capability{"a", "b"}, client: []endpoint.Capability{"b", "c"}, agreed: []endpoint.Capability{"b"}},
+		{server: []endpoint.Capability{"a"}, client: []endpoint.Capability{}, agreed: []endpoint.Capability{}},
+	}
+	for _, c := range cases {
+		hub := local.NewHub()
+		server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+		server.Capabilities = c.server
+		client := &recordBind{Bind: newBind(hub, "client"), eps: make(chan conn.Endpoint, 1)}
+		client.Capabilities = c.client
+
+		dev := startServer(server)
+		dev2, tnet := startClient(client, "server")
+		httpGet(tnet)
+
+		for _, ep := range []conn.Endpoint{<-server.eps, <-client.eps} {
+			caps := ep.(interface{ Capabilities() []endpoint.Capability }).Capabilities()
+			assert.DeepEqual(caps, c.agreed)
+		}
+		dev2.Close()
+		dev.Close()
+	}
+}
+
+func TestChannels(t *testing.T) {
+	hub := local.NewHub()
+	server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+	client := &recordBind{Bind: newBind(hub, "client"), eps: make(chan conn.Endpoint, 1)}
+	dev := startServer(server)
+	defer dev.Close()
+	dev2, tnet := startClient(client, "webrtc://server?channels=4")
+	defer dev2.Close()
+
+	httpGet(tnet)
+	for _, ep := range []conn.Endpoint{<-server.eps, <-client.eps} {
+		ep := ep.(interface{ Channels() int })
+		for i := 0; i < 50 && ep.Channels() != 4; i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.Equal(ep.Channels(), 4)
+	}
+	assert.Equal(download(tnet, 1<<20), 1<<20)
+}
+
+func TestControl(t *testing.T) {
+	hub := local.NewHub()
+	server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+	client := &recordBind{Bind: newBind(hub, "client"), eps: make(chan conn.Endpoint, 1)}
+	dev := startServer(server)
+	defer dev.Close()
+	dev2, tnet := startClient(client, "server")
+	defer dev2.Close()
+
+	httpGet(tnet)
+	for _, ep := range []conn.Endpoint{<-server.eps, <-client.eps} {
+		ep := ep.(interface{ Control() bool })
+		for i := 0; i < 50 && !ep.Control(); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.That(ep.Control())
+	}
+	httpGet(tnet)
+}
+
+func TestFragment(t *testing.T) {
+	hub := local.NewHub()
+	server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+	server.LinkMTU = endpoint.MinLinkMTU
+	server.Fragment = true
+	client := &recordBind{Bind: newBind(hub, "client"), eps: make(chan conn.Endpoint, 1)}
+	dev := startServer(server)
+	defer dev.Close()
+	dev2, tnet := startClient(client, "webrtc://server?mtu=1280&fragment=true")
+	defer dev2.Close()
+
+	httpGet(tnet)
+	for _, ep := range []conn.Endpoint{<-server.eps, <-client.eps} {
+		mtu := ep.(interface{ MTU() int }).MTU()
+		assert.That(mtu < 1420+endpoint.WireguardOverhead, "mtu %d", mtu)
+	}
+	// packets of tun mtu 1420 are fragmented
+	assert.Equal(download(tnet, 1<<20), 1<<20)
+}
+
+func TestPadding(t *testing.T) {
+	hub := local.NewHub()
+	server := newBind(hub, "server")
+	server.Padding = endpoint.PaddingRandom
+	dev := startServer(server)
+	defer dev.Close()
+	dev2, tnet := startClient(newBind(hub, "client"), "webrtc://server?padding=bucket&cover=20ms&fragment=true")
+	defer dev2.Close()
+
+	httpGet(tnet)
+	assert.Equal(download(tnet, 1<<20), 1<<20)
+}
+
+func TestRTP(t *testing.T) {
+	hub := local.NewHub()
+	server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+	client := &recordBind{Bind: newBind(hub, "client"), eps: make(chan conn.Endpoint, 1)}
+	dev := startServer(server)
+	defer dev.Close()
+	dev2, tnet := startClient(client, "webrtc://server?transport=rtp")
+	defer dev2.Close()
+
+	httpGet(tnet)
+	for _, ep := range []conn.Endpoint{<-server.eps, <-client.eps} {
+		ep := ep.(interface{ Channels() int })
+		// no DataChannel is opened
+		assert.Equal(ep.Channels(), 0)
+	}
+	assert.Equal(download(tnet, 1<<20), 1<<20)
+}
+
+// Bind.Transport applies to outbound peers, inbound sessions of peers without rtp keep DataChannels
+func TestRTPMixedCapabilities(t *testing.T) {
+	hub := local.NewHub()
+	server := &recordBind{Bind: newBind(hub, "server"), eps: make(chan conn.Endpoint, 1)}
+	server.Transport = endpoint.TransportRTP
+	client := newBind(hub, "client")
+	for _, c := range endpoint.DefaultCapabilities {
+		if c != endpoint.CapabilityRTP {
+			client.Capabilities = append(client.Capabilities, c)
+		}
+	}
+	dev := startServer(server)
 	defer dev.Close()
-	dev2, tnet := startClient()
+	dev2, tnet := startClient(client, "server")
 	defer dev2.Close()
 
-	client := http.Client{
-		Transport: &http.Transport{
-			DialContext: tnet.DialContext,
-		},
-		Timeout: 10 * time.Second,
+	httpGet(tnet)
+	inbound := (<-server.eps).(*endpoint.Inbound)
+	assert.Equal(inbound.Options.Transport, endpoint.TransportDataChannel)
+}
+
+func TestFingerprint(t *testing.T) {
+	hub := local.NewHub()
+	server := newBind(hub, "server")
+	server.Certificate = try.To1(wgortc.GenerateCertificate())
+	dev := startServer(server)
+	defer dev.Close()
+
+	fps := try.To1(server.Certificate.GetFingerprints())
+	dev2, tnet := startClient(newBind(hub, "client"), "webrtc://server?fingerprint="+endpoint.FormatFingerprint(fps[0]))
+	httpGet(tnet)
+	dev2.Close()
+
+	// a signaler could swap the certificate, the answer isn't pinned then
+	other := try.To1(try.To1(wgortc.GenerateCertificate()).GetFingerprints())
+	client2 := newBind(hub, "client2")
+	dev3, tnet := startClient(client2, "webrtc://server?fingerprint="+endpoint.FormatFingerprint(other[0]))
+	defer dev3.Close()
+	err := handshakeError(t, client2, tnet)
+	assert.That(errors.Is(err, endpoint.ErrFingerprintMismatch), err.Error())
+}
+
+func TestIdentity(t *testing.T) {
+	hub := local.NewHub()
+	server := newBind(hub, "server")
+	server.PrivateKey = try.To1(endpoint.ParseKey(testutil.ServerKey))
+	server.TrustedKeys = []endpoint.Key{try.To1(endpoint.ParseKey(testutil.ClientPub))}
+	dev := startServer(server)
+	defer dev.Close()
+
+	client := newBind(hub, "client")
+	client.PrivateKey = try.To1(endpoint.ParseKey(testutil.ClientKey))
+	_, err := client.ParseEndpoint("server")
+	assert.Error(err)
+	dev2, tnet := startClient(client, "webrtc://server?pubkey="+testutil.ServerPub)
+	httpGet(tnet)
+	dev2.Close()
+
+	// the offer is signed for another key, the server rejects it
+	client2 := newBind(hub, "client2")
+	client2.PrivateKey = try.To1(endpoint.ParseKey(testutil.ClientKey))
+	dev3, tnet := startClient(client2, "webrtc://server?pubkey="+testutil.ClientPub)
+	defer dev3.Close()
+	err = handshakeError(t, client2, tnet)
+	assert.That(errors.Is(err, endpoint.ErrIdentityMismatch), err.Error())
+}
+
+// handshakeError sends a datagram to start the handshake and returns the first permanent failure reported by b,
+// temporary ones are retried by wireguard
+func handshakeError(t *testing.T, b *wgortc.Bind, tnet *netstack.Net) error {
+	c := try.To1(tnet.DialUDP(nil, &net.UDPAddr{IP: net.IPv4(192, 168, 4, 29), Port: 9}))
+	defer c.Close()
+	try.To1(c.Write([]byte("hello")))
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case err := <-b.Errors():
+			if !endpoint.Temporary(err) {
+				return err
+			}
+		case <-timeout:
+			t.Fatal("the handshake failure is not reported")
+			return nil
+		}
 	}
+}
+
+// silentSignaler never answers
+type silentSignaler struct{ signaler.Channel }
+
+func (silentSignaler) Handshake(endpoint string, offer signaler.SDP) (*signaler.SDP, error) {
+	select {}
+}
+
+func TestSignalingTimeout(t *testing.T) {
+	hub := local.NewHub()
+	b := newBind(hub, "client")
+	b.Channel = silentSignaler{b.Channel}
+	b.Timeouts = endpoint.Timeouts{Signaling: 100 * time.Millisecond}
+	try.To2(b.Open(0))
+	defer b.Close()
+
+	ep := try.To1(b.ParseEndpoint("server")).(*endpoint.Outbound)
+	initiator := make([]byte, endpoint.MessageInitiationSize)
+	initiator[0] = endpoint.MessageInitiationType
+	err := ep.Connect(initiator)
+	assert.That(errors.Is(err, endpoint.ErrSignalingTimeout), err.Error())
+	var te *endpoint.TimeoutError
+	assert.That(errors.As(err, &te))
+	assert.Equal(te.After, 100*time.Millisecond)
+	var e *endpoint.Error
+	assert.That(errors.As(err, &e))
+	assert.Equal(e.Phase, endpoint.PhaseSignaling)
+	assert.Equal(e.Peer, "server")
+	assert.That(e.Temporary)
+}
+
+func TestErrors(t *testing.T) {
+	hub := local.NewHub()
+	b := newBind(hub, "client")
+	try.To2(b.Open(0))
+	defer b.Close()
+
+	ep := try.To1(b.ParseEndpoint("nobody"))
+	initiator := make([]byte, endpoint.MessageInitiationSize)
+	initiator[0] = endpoint.MessageInitiationType
+	try.To(b.Send([][]byte{initiator}, ep))
+
+	select {
+	case err := <-b.Errors():
+		assert.That(errors.Is(err, signaler.ErrPeerNotFound), err.Error())
+		var e *endpoint.Error
+		assert.That(errors.As(err, &e))
+		assert.Equal(e.Phase, endpoint.PhaseSignaling)
+		assert.Equal(e.Peer, "nobody")
+		assert.That(e.Temporary)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed handshake is not reported")
+	}
+}
+
+func BenchmarkChannels(b *testing.B) {
+	for _, n := range []int{1, 4} {
+		b.Run(fmt.Sprintf("channels=%d", n), func(b *testing.B) {
+			hub := local.NewHub()
+			dev := startServer(newBind(hub, "server"))
+			defer dev.Close()
+			dev2, tnet := startClient(newBind(hub, "client"), fmt.Sprintf("webrtc://server?channels=%d", n))
+			defer dev2.Close()
+			httpGet(tnet)
 
-	resp := try.To1(client.Get("http://192.168.4.29/"))
-	body := try.To1(io.ReadAll(resp.Body))
-	log.Println(string(body))
+			const size = 1 << 20
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				download(tnet, size)
+			}
+		})
+	}
+}
+
+func download(tnet *netstack.Net, n int) int {
+	return testutil.Download(tnet, n, 30*time.Second)
+}
+
+// recordBind records the first endpoint of peer
+type recordBind struct {
+	*wgortc.Bind
+	eps chan conn.Endpoint
+}
+
+func (b *recordBind) record(ep conn.Endpoint) {
+	select {
+	case b.eps <- ep:
+	default:
+	}
+}
+
+func (b *recordBind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	fns, actualPort, err = b.Bind.Open(port)
+	for i, fn := range fns {
+		fn := fn
+		fns[i] = func(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
+			n, err = fn(packets, sizes, eps)
+			for _, ep := range eps[:n] {
+				b.record(ep)
+			}
+			return
+		}
+	}
 	return
 }
 
-func startServer() (dev *device.Device) {
-	tdev, tnet, err := netstack.CreateNetTUN(
-		[]netip.Addr{netip.MustParseAddr("192.168.4.29")},
-		[]netip.Addr{netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("8.8.4.4")},
-		1420,
-	)
-	try.To(err)
-	s := local.NewServer()
-	hub.Register("server", s)
-	bind := wgortc.NewBind(s)
-	dev = device.NewDevice(tdev, bind, device.NewLogger(loglevel, "server "))
-	dev.IpcSet(`private_key=003ed5d73b55806c30de3f8a7bdab38af13539220533055e635690b8b87ad641
-listen_port=0
-public_key=f928d4f6c1b86c12f2562c10b07c555c5c57fd00f59e90c8d8d88767271cbf7c
-allowed_ip=192.168.4.28/32
-`)
-	try.To(dev.Up())
-
-	listener := try.To1(tnet.ListenTCP(&net.TCPAddr{Port: 80}))
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
-		log.Printf("> %s - %s - %s", request.RemoteAddr, request.URL.String(), request.UserAgent())
-		io.WriteString(writer, "Hello from userspace TCP!")
-	})
-	go func() {
-		try.To(http.Serve(listener, mux))
-	}()
+func (b *recordBind) ParseEndpoint(s string) (ep conn.Endpoint, err error) {
+	if ep, err = b.Bind.ParseEndpoint(s); err == nil {
+		b.record(ep)
+	}
 	return
 }
 
-func startClient() (dev *device.Device, tnet *netstack.Net) {
-	tun, tnet, err := netstack.CreateNetTUN(
-		[]netip.Addr{netip.MustParseAddr("192.168.4.28")},
-		[]netip.Addr{netip.MustParseAddr("8.8.8.8")},
-		1420)
-	try.To(err)
+func TestAnswerTimeout(t *testing.T) {
+	hub := local.NewHub()
+	server := newBind(hub, "server")
+	server.Timeouts = endpoint.Timeouts{Answer: 100 * time.Millisecond}
+	dev := startServer(server)
+	defer dev.Close()
+
+	client := newBind(hub, "client")
+	try.To2(client.Open(0))
+	defer client.Close()
+
+	// wireguard drops the forged initiation and never answers
+	ep := try.To1(client.ParseEndpoint("server")).(*endpoint.Outbound)
+	initiator := make([]byte, endpoint.MessageInitiationSize)
+	initiator[0] = endpoint.MessageInitiationType
+	go ep.Connect(initiator)
+
+	select {
+	case err := <-server.Errors():
+		assert.That(errors.Is(err, endpoint.ErrAnswerTimeout), err.Error())
+		var e *endpoint.Error
+		assert.That(errors.As(err, &e))
+		assert.Equal(e.Phase, endpoint.PhaseAnswer)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the answer timeout is not reported")
+	}
+}
+
+func newBind(hub *local.Hub, name string) *wgortc.Bind {
 	s := local.NewServer()
-	hub.Register("client", s)
-	bind := wgortc.NewBind(s)
-	dev = device.NewDevice(tun, bind, device.NewLogger(loglevel, "client "))
-	err = dev.IpcSet(`private_key=087ec6e14bbed210e7215cdc73468dfa23f080a1bfb8665b2fd809bd99d28379
-public_key=c4c8e984c5322c8184c72265b92b250fdb63688705f504ba003c88f03393cf28
-allowed_ip=0.0.0.0/0
-endpoint=server
-`)
-	try.To(dev.Up())
+	hub.Register(name, s)
+	return wgortc.NewBind(s)
+}
+
+func httpGet(tnet *netstack.Net) {
+	log.Println(testutil.Get(tnet, "/", 10*time.Second))
+}
 
+func startServer(bind conn.Bind) (dev *device.Device) {
+	dev, _ = testutil.StartServer(bind, testutil.ServerConfig)
 	return
 }
+
+func startClient(bind conn.Bind, endpoint string) (dev *device.Device, tnet *netstack.Net) {
+	return testutil.StartClient(bind, endpoint)
+}
@@ -0,0 +1,82 @@
+package endpoint
+
+import (
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+func allowCandidate(types []webrtc.ICECandidateType, t webrtc.ICECandidateType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// RelayOnly reports whether types only allow relay candidates
+func RelayOnly(types []webrtc.ICECandidateType) bool {
+	return len(types) != 0 && !allowCandidate(types, webrtc.ICECandidateTypeHost) &&
+		!allowCandidate(types, webrtc.ICECandidateTypeSrflx) &&
+		!allowCandidate(types, webrtc.ICECandidateTypePrflx)
+}
+
+// FilterICEServers drops stun servers when srflx is not allowed and turn servers when relay is not allowed
+func FilterICEServers(servers []webrtc.ICEServer, types []webrtc.ICECandidateType) (result []webrtc.ICEServer) {
+	if len(types) == 0 {
+		return servers
+	}
+	for _, s := range servers {
+		var urls []string
+		for _, u := range s.URLs {
+			t := webrtc.ICECandidateTypeSrflx
+			if strings.HasPrefix(u, "turn") {
+				t = webrtc.ICECandidateTypeRelay
+			}
+			if allowCandidate(types, t) {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) != 0 {
+			s.URLs = urls
+			result = append(result, s)
+		}
+	}
+	return
+}
+
+// FilterCandidates removes the candidates which type is not allowed from sdp,
+// so they are never leaked through signaler
+func FilterCandidates(sd *sdp.SessionDescription, types []webrtc.ICECandidateType) {
+	if len(types) == 0 {
+		return
+	}
+	for _, m := range sd.MediaDescriptions {
+		attrs := m.Attributes[:0]
+		for _, a := range m.Attributes {
+			if a.Key == "candidate" {
+				if t, ok := candidateType(a.Value); ok && !allowCandidate(types, t) {
+					continue
+				}
+			}
+			attrs = append(attrs, a)
+		}
+		m.Attributes = attrs
+	}
+}
+
+func candidateType(candidate string) (t webrtc.ICECandidateType, ok bool) {
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "typ" {
+			t, err := webrtc.NewICECandidateType(fields[i+1])
+			return t, err == nil
+		}
+	}
+	return
+}
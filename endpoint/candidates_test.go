@@ -0,0 +1,41 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestFilterCandidates(t *testing.T) {
+	sd := &sdp.SessionDescription{
+		MediaDescriptions: []*sdp.MediaDescription{
+			{
+				Attributes: []sdp.Attribute{
+					{Key: "mid", Value: "0"},
+					{Key: "candidate", Value: "1 1 udp 2130706431 192.0.2.2 51820 typ host"},
+					{Key: "candidate", Value: "2 1 udp 1694498815 203.0.113.1 51820 typ srflx raddr 0.0.0.0 rport 51820"},
+					{Key: "candidate", Value: "3 1 udp 16777215 198.51.100.1 3478 typ relay raddr 203.0.113.1 rport 51820"},
+					{Key: "end-of-candidates"},
+				},
+			},
+		},
+	}
+	FilterCandidates(sd, []webrtc.ICECandidateType{webrtc.ICECandidateTypeRelay})
+	attrs := sd.MediaDescriptions[0].Attributes
+	assert.SLen(attrs, 3)
+	assert.Equal(attrs[1].Value, "3 1 udp 16777215 198.51.100.1 3478 typ relay raddr 203.0.113.1 rport 51820")
+
+	servers := []webrtc.ICEServer{
+		{URLs: []string{"stun:127.0.0.1:3478", "turn:127.0.0.1:3478"}},
+		{URLs: []string{"turns:127.0.0.1:5349"}},
+	}
+	assert.SLen(FilterICEServers(servers, []webrtc.ICECandidateType{webrtc.ICECandidateTypeHost}), 0)
+	servers = FilterICEServers(servers, []webrtc.ICECandidateType{webrtc.ICECandidateTypeSrflx})
+	assert.SLen(servers, 1)
+	assert.DeepEqual(servers[0].URLs, []string{"stun:127.0.0.1:3478"})
+
+	assert.That(RelayOnly([]webrtc.ICECandidateType{webrtc.ICECandidateTypeRelay}))
+	assert.ThatNot(RelayOnly(nil))
+}
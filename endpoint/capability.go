@@ -0,0 +1,43 @@
+package endpoint
+
+import "github.com/pion/sdp/v3"
+
+// Capability is a feature which is used only when both peers support it,
+// it is advertised in the Envelope of offer and answer
+type Capability string
+
+// DefaultCapabilities are supported by this version, Bind advertises them by default
+var DefaultCapabilities = []Capability{CapabilityChannels, CapabilityControl, CapabilityReliability, CapabilityFragment, CapabilityPadding, CapabilityRTP, CapabilityMTU}
+
+// Intersect returns the capabilities of local which remote supports too, in local order
+func Intersect(local, remote []Capability) (caps []Capability) {
+	caps = []Capability{}
+	for _, c := range local {
+		if HasCapability(remote, c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+func HasCapability(caps []Capability, c Capability) bool {
+	for _, c2 := range caps {
+		if c2 == c {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteCapabilities returns nil for the peer which doesn't know the envelope
+func remoteCapabilities(sd *sdp.SessionDescription) []Capability {
+	return remoteEnvelope(sd).Capabilities
+}
+
+func remoteEnvelope(sd *sdp.SessionDescription) Envelope {
+	env, _, err := GetEnvelope(sd)
+	if err != nil {
+		return Envelope{}
+	}
+	return env
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"sync/atomic"
 
 	"github.com/pion/webrtc/v3"
 	"golang.zx2c4.com/wireguard/conn"
@@ -15,6 +16,8 @@ type Sender interface {
 
 type baseEndpoint struct {
 	id string
+
+	capabilities atomic.Pointer[[]Capability]
 }
 
 var _ conn.Endpoint = (*baseEndpoint)(nil)
@@ -23,6 +26,19 @@ var _ conn.Endpoint = (*baseEndpoint)(nil)
 func (ep *baseEndpoint) DstToBytes() []byte {
 	return []byte(ep.id)
 }
+
+// Capabilities are agreed with the peer during handshake
+func (ep *baseEndpoint) Capabilities() []Capability {
+	if caps := ep.capabilities.Load(); caps != nil {
+		return *caps
+	}
+	return nil
+}
+
+func (ep *baseEndpoint) setCapabilities(caps []Capability) {
+	ep.capabilities.Store(&caps)
+}
+
 func (ep *baseEndpoint) DstToString() string { return getPCRemote(nil) } // returns the destination address (ip:port)
 
 func (*baseEndpoint) ClearSrc()           {}            // clears the source address
@@ -0,0 +1,138 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+// EnvelopeAttr is the sdp session attribute which carries the Envelope
+//
+//	a=wgortc:<version> <base64 message> [caps=<cap>,<cap>] [<key>=<value>]...
+const EnvelopeAttr = "wgortc"
+
+// EnvelopeVersion is the version written by this Bind.
+// version 0 means the peer only put the message into SessionInformation
+const EnvelopeVersion = 1
+
+// MaxEnvelopeSize limits the envelope attribute accepted from remote sdp
+const MaxEnvelopeSize = 1024
+
+var ErrInvalidEnvelope = errors.New("wgortc envelope in sdp is invalid")
+
+// Envelope is the versioned handshake payload exchanged in offer and answer
+type Envelope struct {
+	Version int
+	// Message is the wireguard handshake initiator or responder
+	Message []byte
+	// Capabilities are the features supported by the peer, unknown ones must be ignored
+	Capabilities []Capability
+	// Extensions are optional key values, unknown ones must be ignored
+	Extensions map[string]string
+}
+
+const capsKey = "caps"
+
+func (env Envelope) String() string {
+	fields := []string{
+		strconv.Itoa(env.Version),
+		messageEncoding.EncodeToString(env.Message),
+	}
+	if len(env.Capabilities) != 0 {
+		caps := make([]string, len(env.Capabilities))
+		for i, c := range env.Capabilities {
+			caps[i] = string(c)
+		}
+		fields = append(fields, capsKey+"="+strings.Join(caps, ","))
+	}
+	keys := make([]string, 0, len(env.Extensions))
+	for k := range env.Extensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, k+"="+env.Extensions[k])
+	}
+	return strings.Join(fields, " ")
+}
+
+// ParseEnvelope parses the value of EnvelopeAttr
+func ParseEnvelope(s string) (env Envelope, err error) {
+	if len(s) > MaxEnvelopeSize {
+		return env, fmt.Errorf("%w: %d bytes", ErrInvalidEnvelope, len(s))
+	}
+	fields := strings.Split(s, " ")
+	if len(fields) < 2 {
+		return env, fmt.Errorf("%w: message is required", ErrInvalidEnvelope)
+	}
+	if env.Version, err = strconv.Atoi(fields[0]); err != nil || env.Version < 1 {
+		return env, fmt.Errorf("%w: version %q", ErrInvalidEnvelope, fields[0])
+	}
+	if env.Message, err = decodeMessage(fields[1]); err != nil {
+		return
+	}
+	for _, f := range fields[2:] {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok || k == "" {
+			return env, fmt.Errorf("%w: field %q", ErrInvalidEnvelope, f)
+		}
+		if k == capsKey {
+			if env.Capabilities != nil {
+				return env, fmt.Errorf("%w: duplicated %s", ErrInvalidEnvelope, k)
+			}
+			env.Capabilities = []Capability{}
+			for _, c := range strings.Split(v, ",") {
+				if c != "" {
+					env.Capabilities = append(env.Capabilities, Capability(c))
+				}
+			}
+			continue
+		}
+		if env.Extensions == nil {
+			env.Extensions = make(map[string]string)
+		}
+		if _, ok := env.Extensions[k]; ok {
+			return env, fmt.Errorf("%w: duplicated %s", ErrInvalidEnvelope, k)
+		}
+		env.Extensions[k] = v
+	}
+	return env, nil
+}
+
+// SetEnvelope puts the envelope into sdp,
+// the message is also put into SessionInformation for peers which don't know the envelope
+func SetEnvelope(sd *sdp.SessionDescription, env Envelope) {
+	if env.Version == 0 {
+		env.Version = EnvelopeVersion
+	}
+	info := sdp.Information(messageEncoding.EncodeToString(env.Message))
+	sd.SessionInformation = &info
+
+	attrs := sd.Attributes[:0]
+	for _, a := range sd.Attributes {
+		if a.Key != EnvelopeAttr {
+			attrs = append(attrs, a)
+		}
+	}
+	sd.Attributes = append(attrs, sdp.NewAttribute(EnvelopeAttr, env.String()))
+}
+
+// GetEnvelope extracts the envelope from sdp, it falls back to SessionInformation as version 0.
+// ok is false if there is neither
+func GetEnvelope(sd *sdp.SessionDescription) (env Envelope, ok bool, err error) {
+	if v, found := sd.Attribute(EnvelopeAttr); found {
+		env, err = ParseEnvelope(v)
+		return env, err == nil, err
+	}
+	if sd.SessionInformation == nil {
+		return env, false, nil
+	}
+	if env.Message, err = decodeMessage(string(*sd.SessionInformation)); err != nil {
+		return
+	}
+	return env, true, nil
+}
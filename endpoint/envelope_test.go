@@ -0,0 +1,78 @@
+package endpoint
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/sdp/v3"
+)
+
+func TestEnvelope(t *testing.T) {
+	initiation := newMessage(MessageInitiationType, MessageInitiationSize)
+	env := Envelope{
+		Message:      initiation,
+		Capabilities: []Capability{"a", "b"},
+		Extensions:   map[string]string{"x": "1", "y": "2"},
+	}
+
+	sd := &sdp.SessionDescription{}
+	try.To(sd.Unmarshal([]byte(sessionSDP("-"))))
+	SetEnvelope(sd, env)
+	SetEnvelope(sd, env)
+	sd2 := &sdp.SessionDescription{}
+	try.To(sd2.Unmarshal(try.To1(sd.Marshal())))
+
+	v, ok := sd2.Attribute(EnvelopeAttr)
+	assert.That(ok)
+	assert.Equal(v, "1 "+base64.StdEncoding.EncodeToString(initiation)+" caps=a,b x=1 y=2")
+	env2, ok, err := GetEnvelope(sd2)
+	try.To(err)
+	assert.That(ok)
+	assert.Equal(env2.Version, EnvelopeVersion)
+	assert.DeepEqual(env2.Message, initiation)
+	assert.DeepEqual(env2.Capabilities, env.Capabilities)
+	assert.DeepEqual(env2.Extensions, env.Extensions)
+
+	// peers before the envelope only read SessionInformation
+	assert.Equal(string(*sd2.SessionInformation), base64.StdEncoding.EncodeToString(initiation))
+
+	// and only write SessionInformation
+	legacy := &sdp.SessionDescription{}
+	try.To(legacy.Unmarshal([]byte(sessionSDP(base64.StdEncoding.EncodeToString(initiation)))))
+	env2, ok, err = GetEnvelope(legacy)
+	try.To(err)
+	assert.That(ok)
+	assert.Equal(env2.Version, 0)
+	assert.DeepEqual(try.To1(Initiator(legacy)), initiation)
+
+	_, ok, err = GetEnvelope(&sdp.SessionDescription{})
+	try.To(err)
+	assert.That(!ok)
+
+	for _, s := range []string{
+		"",
+		"1",
+		"0 AQAAAA==",
+		"x AQAAAA==",
+		"1 AQAAAA",
+		"1 AQAAAA== ext",
+		"1 AQAAAA== =1",
+		"1 AQAAAA== x=1 x=2",
+		"1 AQAAAA== caps=a caps=b",
+	} {
+		_, err := ParseEnvelope(s)
+		assert.Error(err, s)
+	}
+
+	// newer versions keep the leading fields
+	env2 = try.To1(ParseEnvelope("2 AQAAAA== caps=a,future future=1"))
+	assert.Equal(env2.Version, 2)
+	assert.DeepEqual(env2.Message, []byte{1, 0, 0, 0})
+	assert.DeepEqual(env2.Capabilities, []Capability{"a", "future"})
+
+	assert.DeepEqual(Intersect([]Capability{"a", "b", "c"}, []Capability{"c", "b"}), []Capability{"b", "c"})
+	// peers before the envelope support nothing
+	assert.SLen(Intersect([]Capability{"a"}, remoteCapabilities(legacy)), 0)
+}
@@ -0,0 +1,96 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/shynome/wgortc/signaler"
+)
+
+// Error is returned by Connect, HandleConnect and ExtractInitiator,
+// it tells which phase failed with which peer, get it by errors.As
+type Error struct {
+	Phase Phase
+	// Peer is the endpoint id of outbound, or the verified wireguard public key of inbound,
+	// empty when it is unknown
+	Peer string
+	Err  error
+	// Temporary errors may succeed on retry, such as timeouts and peers not ready yet,
+	// the others won't until the config changes, such as mismatched fingerprints
+	Temporary bool
+}
+
+func (e *Error) Error() string {
+	if e.Peer == "" {
+		return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Phase, e.Peer, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// NewError wraps err as *Error, nil stays nil.
+// the phase of the cause is preferred, such as TimeoutError and ErrICEClosed
+func NewError(phase Phase, peer string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Peer == peer {
+			return err
+		}
+		phase = e.Phase
+	} else {
+		phase = causePhase(phase, err)
+	}
+	return &Error{Phase: phase, Peer: peer, Err: err, Temporary: Temporary(err)}
+}
+
+func causePhase(phase Phase, err error) Phase {
+	var t *TimeoutError
+	switch {
+	case errors.As(err, &t):
+		return t.Phase
+	case errors.Is(err, ErrICEClosed):
+		return PhaseICE
+	case errors.Is(err, ErrDataChannelClosed), errors.Is(err, ErrDTLSClosed):
+		return PhaseDataChannel
+	}
+	return phase
+}
+
+// report passes err of peer to OnError
+func (o Options) report(phase Phase, peer string, err error) {
+	if err != nil && o.OnError != nil {
+		o.OnError(NewError(phase, peer, err))
+	}
+}
+
+// Temporary reports whether err may succeed on retry
+func Temporary(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Temporary
+	}
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	for _, target := range []error{
+		context.DeadlineExceeded,
+		net.ErrClosed,
+		ErrICEClosed,
+		ErrDataChannelClosed,
+		ErrDTLSClosed,
+		signaler.ErrPeerNotFound,
+		signaler.ErrPeerNotReady,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/shynome/wgortc/signaler"
+)
+
+func TestError(t *testing.T) {
+	assert.That(NewError(PhaseSetup, "server", nil) == nil)
+
+	err := NewError(PhaseSignaling, "server", fmt.Errorf("%w: server", signaler.ErrPeerNotFound))
+	var e *Error
+	assert.That(errors.As(err, &e))
+	assert.Equal(e.Phase, PhaseSignaling)
+	assert.That(e.Temporary)
+	assert.That(errors.Is(err, signaler.ErrPeerNotFound))
+	assert.Equal(err.Error(), "signaling server: peer is not found: server")
+	assert.Equal(NewError(PhaseSetup, "server", err), err)
+
+	// the phase of the cause is preferred
+	err = NewError(PhaseSetup, "", &TimeoutError{Phase: PhaseICE, After: time.Second})
+	assert.That(errors.As(err, &e))
+	assert.Equal(e.Phase, PhaseICE)
+	assert.That(Temporary(err))
+	assert.That(errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(err.Error(), "ice: ice timeout after 1s")
+	err = NewError(PhaseICE, "", ErrDataChannelClosed)
+	assert.That(errors.As(err, &e))
+	assert.Equal(e.Phase, PhaseDataChannel)
+
+	err = NewError(PhaseVerify, "", ErrFingerprintMismatch)
+	assert.That(errors.As(err, &e))
+	assert.That(!e.Temporary)
+	assert.That(!Temporary(ErrIdentityMismatch))
+
+	// the peer is known later
+	err = NewError(PhaseSetup, "peer", NewError(PhaseVerify, "", ErrIdentityMismatch))
+	assert.That(errors.As(err, &e))
+	assert.Equal(e.Phase, PhaseVerify)
+	assert.Equal(e.Peer, "peer")
+}
@@ -0,0 +1,76 @@
+package endpoint
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+var ErrFingerprintMismatch = errors.New("dtls fingerprint of answer is not pinned")
+
+const fingerprintAttr = "fingerprint"
+
+// ParseFingerprint parses the uri form `sha-256:AB:CD:...` of a dtls certificate fingerprint
+func ParseFingerprint(s string) (fp webrtc.DTLSFingerprint, err error) {
+	algorithm, value, ok := strings.Cut(s, ":")
+	if !ok || algorithm == "" {
+		return fp, fmt.Errorf("invalid fingerprint %q", s)
+	}
+	if _, err = hex.DecodeString(strings.ReplaceAll(value, ":", "")); err != nil || value == "" {
+		return fp, fmt.Errorf("invalid fingerprint %q", s)
+	}
+	return webrtc.DTLSFingerprint{Algorithm: strings.ToLower(algorithm), Value: strings.ToLower(value)}, nil
+}
+
+// FormatFingerprint returns the uri form of fp, which ParseFingerprint accepts
+func FormatFingerprint(fp webrtc.DTLSFingerprint) string {
+	return strings.ToLower(fp.Algorithm) + ":" + strings.ToUpper(fp.Value)
+}
+
+// sdpFingerprints returns the normalized `a=fingerprint` of session and media level
+func sdpFingerprints(sd *sdp.SessionDescription) (fps []webrtc.DTLSFingerprint) {
+	add := func(attrs []sdp.Attribute) {
+		for _, a := range attrs {
+			if a.Key != fingerprintAttr {
+				continue
+			}
+			algorithm, value, _ := strings.Cut(a.Value, " ")
+			fps = append(fps, webrtc.DTLSFingerprint{Algorithm: strings.ToLower(algorithm), Value: strings.ToLower(value)})
+		}
+	}
+	add(sd.Attributes)
+	for _, m := range sd.MediaDescriptions {
+		add(m.Attributes)
+	}
+	return
+}
+
+// VerifyFingerprints requires every fingerprint of sd is pinned, nothing is checked without pins
+func VerifyFingerprints(sd *sdp.SessionDescription, pins []webrtc.DTLSFingerprint) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	fps := sdpFingerprints(sd)
+	if len(fps) == 0 {
+		return fmt.Errorf("%w: no fingerprint", ErrFingerprintMismatch)
+	}
+	for _, fp := range fps {
+		if !pinned(pins, fp) {
+			return fmt.Errorf("%w: %s", ErrFingerprintMismatch, FormatFingerprint(fp))
+		}
+	}
+	return nil
+}
+
+func pinned(pins []webrtc.DTLSFingerprint, fp webrtc.DTLSFingerprint) bool {
+	for _, pin := range pins {
+		if strings.EqualFold(pin.Algorithm, fp.Algorithm) && strings.EqualFold(pin.Value, fp.Value) {
+			return true
+		}
+	}
+	return false
+}
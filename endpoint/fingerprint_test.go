@@ -0,0 +1,35 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestVerifyFingerprints(t *testing.T) {
+	fp := try.To1(ParseFingerprint("SHA-256:AB:cd:01"))
+	assert.Equal(fp, webrtc.DTLSFingerprint{Algorithm: "sha-256", Value: "ab:cd:01"})
+	assert.Equal(FormatFingerprint(fp), "sha-256:AB:CD:01")
+	for _, s := range []string{"", "sha-256", "sha-256:", ":AB", "sha-256:XY"} {
+		_, err := ParseFingerprint(s)
+		assert.Error(err, s)
+	}
+
+	sd := &sdp.SessionDescription{
+		Attributes: []sdp.Attribute{{Key: "fingerprint", Value: "sha-256 AB:CD:01"}},
+		MediaDescriptions: []*sdp.MediaDescription{
+			{Attributes: []sdp.Attribute{{Key: "fingerprint", Value: "sha-256 AB:CD:01"}}},
+		},
+	}
+	try.To(VerifyFingerprints(sd, nil))
+	try.To(VerifyFingerprints(sd, []webrtc.DTLSFingerprint{fp}))
+	assert.Error(VerifyFingerprints(sd, []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "ab:cd:02"}}))
+	assert.Error(VerifyFingerprints(&sdp.SessionDescription{}, []webrtc.DTLSFingerprint{fp}))
+
+	// every fingerprint must be pinned
+	sd.MediaDescriptions[0].Attributes[0].Value = "sha-256 AB:CD:02"
+	assert.Error(VerifyFingerprints(sd, []webrtc.DTLSFingerprint{fp}))
+}
@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// CapabilityFragment means the peer reassembles fragments
+const CapabilityFragment Capability = "fragment"
+
+const (
+	// fragmentType doesn't collide with wireguard message types
+	fragmentType = 0xfe
+	// type, id, index and count
+	fragmentHeaderSize = 1 + 2 + 1 + 1
+	maxFragments       = 16
+	// incomplete packets are dropped when more are pending
+	maxPendingFragments = 64
+)
+
+// fragment splits buf into fragments whose size is at most size
+func fragment(buf []byte, size int, id uint16) (frags [][]byte) {
+	payload := size - fragmentHeaderSize
+	if payload <= 0 {
+		return [][]byte{buf}
+	}
+	count := (len(buf) + payload - 1) / payload
+	if count > maxFragments {
+		return [][]byte{buf}
+	}
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(buf) {
+			end = len(buf)
+		}
+		frag := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*payload)
+		frag[0] = fragmentType
+		binary.BigEndian.PutUint16(frag[1:], id)
+		frag[3] = byte(i)
+		frag[4] = byte(count)
+		frags = append(frags, append(frag, buf[i*payload:end]...))
+	}
+	return
+}
+
+func isFragment(buf []byte) bool {
+	return len(buf) > fragmentHeaderSize && buf[0] == fragmentType
+}
+
+// reassembler joins fragments which may arrive out of order from striped DataChannels
+type reassembler struct {
+	pending map[uint16][][]byte
+	order   []uint16
+	locker  sync.Mutex
+}
+
+// add returns the packet once all fragments arrived
+func (r *reassembler) add(frag []byte) (buf []byte) {
+	id := binary.BigEndian.Uint16(frag[1:])
+	index, count := int(frag[3]), int(frag[4])
+	if count == 0 || count > maxFragments || index >= count {
+		return nil
+	}
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[uint16][][]byte)
+	}
+	parts, ok := r.pending[id]
+	if !ok {
+		if len(r.order) >= maxPendingFragments {
+			delete(r.pending, r.order[0])
+			r.order = r.order[1:]
+		}
+		parts = make([][]byte, count)
+		r.pending[id] = parts
+		r.order = append(r.order, id)
+	}
+	if len(parts) != count {
+		return nil
+	}
+	parts[index] = frag[fragmentHeaderSize:]
+	for _, p := range parts {
+		if p == nil {
+			return nil
+		}
+		buf = append(buf, p...)
+	}
+	delete(r.pending, id)
+	for i, v := range r.order {
+		if v == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return buf
+}
@@ -0,0 +1,39 @@
+package endpoint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lainio/err2/assert"
+)
+
+func TestReassemble(t *testing.T) {
+	buf := newMessage(messageTransportType, 1452)
+	frags := fragment(buf, 500, 7)
+	assert.SLen(frags, 3)
+	for _, frag := range frags {
+		assert.That(len(frag) <= 500)
+		assert.That(isFragment(frag))
+	}
+
+	r := &reassembler{}
+	// fragments arrive out of order from striped channels
+	assert.SLen(r.add(frags[2]), 0)
+	assert.SLen(r.add(frags[0]), 0)
+	assert.That(bytes.Equal(r.add(frags[1]), buf))
+	assert.Equal(len(r.pending), 0)
+
+	// incomplete packets are evicted
+	for i := 0; i < maxPendingFragments+1; i++ {
+		r.add(fragment(buf, 500, uint16(i))[0])
+	}
+	assert.Equal(len(r.pending), maxPendingFragments)
+	_, ok := r.pending[0]
+	assert.That(!ok)
+
+	// too many fragments are not split
+	assert.SLen(fragment(buf, 50, 1), 1)
+	// no room for payload
+	assert.SLen(fragment(buf, fragmentHeaderSize, 1), 1)
+	assert.That(!isFragment(buf))
+}
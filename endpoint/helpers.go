@@ -45,3 +45,82 @@ func WaitDC(dc *webrtc.DataChannel, timeout time.Duration) (err error) {
 
 	return
 }
+
+var ErrDTLSClosed = errors.New("DTLSTransport state is closed")
+
+func WaitDTLS(dtls *webrtc.DTLSTransport, timeout time.Duration) (err error) {
+	switch dtls.State() {
+	case webrtc.DTLSTransportStateConnected:
+		return
+	case webrtc.DTLSTransportStateClosed, webrtc.DTLSTransportStateFailed:
+		return ErrDTLSClosed
+	}
+
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx, cancelWith := context.WithCancelCause(ctx)
+
+	dtls.OnStateChange(func(s webrtc.DTLSTransportState) {
+		switch s {
+		case webrtc.DTLSTransportStateConnected:
+			cancelWith(nil)
+		case webrtc.DTLSTransportStateClosed, webrtc.DTLSTransportStateFailed:
+			cancelWith(ErrDTLSClosed)
+		}
+	})
+	// the state may change before the handler is set
+	if dtls.State() == webrtc.DTLSTransportStateConnected {
+		return nil
+	}
+
+	<-ctx.Done()
+
+	switch err = context.Cause(ctx); err {
+	case context.Canceled:
+		return nil
+	}
+
+	return
+}
+
+var ErrICEClosed = errors.New("ICE connection state is failed or closed")
+
+func WaitICE(pc *webrtc.PeerConnection, timeout time.Duration) (err error) {
+	connected := func(s webrtc.ICEConnectionState) bool {
+		return s == webrtc.ICEConnectionStateConnected || s == webrtc.ICEConnectionStateCompleted
+	}
+	switch s := pc.ICEConnectionState(); {
+	case connected(s):
+		return
+	case s == webrtc.ICEConnectionStateFailed, s == webrtc.ICEConnectionStateClosed:
+		return ErrICEClosed
+	}
+
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx, cancelWith := context.WithCancelCause(ctx)
+
+	pc.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
+		switch {
+		case connected(s):
+			cancelWith(nil)
+		case s == webrtc.ICEConnectionStateFailed, s == webrtc.ICEConnectionStateClosed:
+			cancelWith(ErrICEClosed)
+		}
+	})
+	// the state may change before the handler is set
+	if connected(pc.ICEConnectionState()) {
+		return nil
+	}
+
+	<-ctx.Done()
+
+	switch err = context.Cause(ctx); err {
+	case context.Canceled:
+		return nil
+	}
+
+	return
+}
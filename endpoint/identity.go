@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/pion/sdp/v3"
+	"golang.org/x/crypto/curve25519"
+)
+
+// CapabilityIdentity means the peer binds its dtls fingerprint to its wireguard key
+const CapabilityIdentity Capability = "identity"
+
+var (
+	ErrIdentityMismatch = errors.New("dtls identity is not bound to a trusted wireguard key")
+	ErrPeerKeyRequired  = errors.New("wireguard public key of peer is required to bind dtls identity")
+)
+
+const (
+	pubkeyKey   = "pubkey"
+	identityKey = "identity"
+
+	identityLabel = "wgortc identity v1"
+	// roles of the tag, so the tag of offer can't be reflected as the tag of answer
+	roleOffer  byte = 'o'
+	roleAnswer byte = 'a'
+)
+
+// Key is a wireguard curve25519 key
+type Key [32]byte
+
+// ParseKey parses the hex form of wireguard uapi or the base64 form of wg config
+func ParseKey(s string) (k Key, err error) {
+	var b []byte
+	switch len(s) {
+	case hex.EncodedLen(len(k)):
+		b, err = hex.DecodeString(s)
+	case base64.StdEncoding.EncodedLen(len(k)):
+		b, err = base64.StdEncoding.DecodeString(s)
+	default:
+		err = fmt.Errorf("key length %d", len(s))
+	}
+	if err != nil {
+		return k, fmt.Errorf("invalid key: %w", err)
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+func (k Key) String() string { return base64.StdEncoding.EncodeToString(k[:]) }
+
+func (k Key) Bytes() []byte { return k[:] }
+
+func (k Key) IsZero() bool { return k == Key{} }
+
+// PublicKey returns the public key of the private key k
+func (k Key) PublicKey() (pub Key) {
+	b, _ := curve25519.X25519(k[:], curve25519.Basepoint)
+	copy(pub[:], b)
+	return
+}
+
+func (o Options) identity() bool { return !o.PrivateKey.IsZero() }
+
+// identityTag authenticates the dtls fingerprints and the wireguard message of sd
+// with the static-static shared secret, only the holders of both keys could compute it
+func identityTag(priv, peer Key, role byte, sd *sdp.SessionDescription, msg []byte) ([]byte, error) {
+	fps := sdpFingerprints(sd)
+	if len(fps) == 0 {
+		return nil, fmt.Errorf("%w: no fingerprint", ErrIdentityMismatch)
+	}
+	shared, err := curve25519.X25519(priv[:], peer[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIdentityMismatch, err)
+	}
+	mac := hmac.New(sha256.New, shared)
+	mac.Write([]byte(identityLabel))
+	mac.Write([]byte{role})
+	for _, fp := range fps {
+		mac.Write([]byte(fp.Algorithm + " " + fp.Value + "\n"))
+	}
+	mac.Write(msg)
+	return mac.Sum(nil), nil
+}
+
+// signIdentity returns the envelope extensions which bind sd to the local wireguard key
+func signIdentity(priv, peer Key, role byte, sd *sdp.SessionDescription, msg []byte) (map[string]string, error) {
+	tag, err := identityTag(priv, peer, role, sd, msg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		pubkeyKey:   hex.EncodeToString(priv.PublicKey().Bytes()),
+		identityKey: hex.EncodeToString(tag),
+	}, nil
+}
+
+// verifyIdentity returns the wireguard key of peer which has signed sd, it must be one of trusted
+func verifyIdentity(priv Key, trusted []Key, role byte, sd *sdp.SessionDescription, env Envelope) (peer Key, err error) {
+	if peer, err = ParseKey(env.Extensions[pubkeyKey]); err != nil {
+		return peer, fmt.Errorf("%w: %w", ErrIdentityMismatch, err)
+	}
+	if !hasKey(trusted, peer) {
+		return peer, fmt.Errorf("%w: untrusted key %s", ErrIdentityMismatch, peer)
+	}
+	tag, err := hex.DecodeString(env.Extensions[identityKey])
+	if err != nil {
+		return peer, fmt.Errorf("%w: %w", ErrIdentityMismatch, err)
+	}
+	expected, err := identityTag(priv, peer, role, sd, env.Message)
+	if err != nil {
+		return
+	}
+	if !hmac.Equal(tag, expected) {
+		return peer, ErrIdentityMismatch
+	}
+	return peer, nil
+}
+
+func hasKey(keys []Key, k Key) bool {
+	for _, k2 := range keys {
+		if k2 == k {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeExtensions(exts ...map[string]string) map[string]string {
+	m := make(map[string]string)
+	for _, ext := range exts {
+		for k, v := range ext {
+			m[k] = v
+		}
+	}
+	return m
+}
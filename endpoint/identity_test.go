@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/sdp/v3"
+	"github.com/shynome/wgortc/internal/testutil"
+)
+
+func TestIdentityTag(t *testing.T) {
+	server := try.To1(ParseKey(testutil.ServerKey))
+	client := try.To1(ParseKey(testutil.ClientKey))
+	assert.Equal(server.PublicKey(), try.To1(ParseKey(testutil.ServerPub)))
+	assert.Equal(try.To1(ParseKey(client.String())), client)
+	for _, s := range []string{"", "00", "!!" + server.String()[2:]} {
+		_, err := ParseKey(s)
+		assert.Error(err, s)
+	}
+
+	sd := &sdp.SessionDescription{
+		Attributes: []sdp.Attribute{{Key: "fingerprint", Value: "sha-256 AB:CD:01"}},
+	}
+	msg := []byte("initiator")
+	exts := try.To1(signIdentity(client, server.PublicKey(), roleOffer, sd, msg))
+	env := Envelope{Message: msg, Extensions: exts}
+	trusted := []Key{client.PublicKey()}
+	peer := try.To1(verifyIdentity(server, trusted, roleOffer, sd, env))
+	assert.Equal(peer, client.PublicKey())
+
+	// the tag of offer isn't valid for answer
+	_, err := verifyIdentity(server, trusted, roleAnswer, sd, env)
+	assert.Error(err)
+	// the peer must be trusted
+	_, err = verifyIdentity(server, []Key{server.PublicKey()}, roleOffer, sd, env)
+	assert.Error(err)
+	// the message can't be spliced into another session
+	_, err = verifyIdentity(server, trusted, roleOffer, sd, Envelope{Message: []byte("other"), Extensions: exts})
+	assert.Error(err)
+	// nor the dtls fingerprint replaced
+	sd.Attributes[0].Value = "sha-256 AB:CD:02"
+	_, err = verifyIdentity(server, trusted, roleOffer, sd, env)
+	assert.Error(err)
+	_, err = verifyIdentity(server, trusted, roleOffer, sd, Envelope{Message: msg})
+	assert.Error(err)
+}
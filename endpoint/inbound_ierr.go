@@ -5,13 +5,10 @@
 package endpoint
 
 import (
-	"context"
-	"encoding/base64"
 	"errors"
 	"net"
-	"time"
+	"sync"
 
-	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/shynome/wgortc/signaler"
 	"golang.zx2c4.com/wireguard/conn"
@@ -19,11 +16,13 @@ import (
 
 type Inbound struct {
 	baseEndpoint
-	dc	*webrtc.DataChannel
+	transport
+	Options	Options
+
 	sess	signaler.Session
 
 	pc	*webrtc.PeerConnection
-	ch	chan []byte
+	done	chan struct{}
 }
 
 var (
@@ -32,129 +31,239 @@ var (
 )
 
 func NewInbound(sess signaler.Session, pc *webrtc.PeerConnection) *Inbound {
-	return &Inbound{
+	ep := &Inbound{
 		baseEndpoint: baseEndpoint{
 			id: sess.Description().SDP,
 		},
-		pc:	pc,
-		sess:	sess,
-		ch:	make(chan []byte),
+		transport:	newTransport(),
+		pc:		pc,
+		sess:		sess,
+		done:		make(chan struct{}),
 	}
+	ep.onError = func(err error) { ep.Options.report(PhaseSend, ep.peer(), err) }
+	var once sync.Once
+	pc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
+		switch pcs {
+		case webrtc.PeerConnectionStateDisconnected:
+			pc.Close()
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			once.Do(func() { close(ep.done) })
+		}
+	})
+	return ep
 }
 
 func (ep *Inbound) Send(buf []byte) (err error) {
 	closed := ep.dcIsClosed()
 	if buf[0] == 2 && closed {
-		go ep.HandleConnect(buf)
+		// wireguard reuses buf once Send returns
+		buf = append([]byte(nil), buf...)
+		go func() { ep.Options.report(PhaseSetup, ep.peer(), ep.HandleConnect(buf)) }()
 		return
 	}
 	if closed {
 		return net.ErrClosed
 	}
-	go ep.dc.Send(buf)
+	ep.send(buf)
 	return
 }
 
-func (ep *Inbound) dcIsClosed() bool {
-	if ep.dc == nil {
-		return true
-	}
-	return ep.dc.ReadyState() != webrtc.DataChannelStateOpen
-}
-
 func (ep *Inbound) ExtractInitiator() (initiator []byte, ierr error) {
+	// the peer is unknown until its identity is verified
+	defer func() {
+		ierr = NewError(PhaseVerify, "", ierr)
+		if ierr != nil {
+			return
+		}
+	}()
+
 	offer := ep.sess.Description()
 	sdp, ierr := offer.Unmarshal()
 	if ierr != nil {
 		return
 	}
-	rawStr := sdp.SessionInformation
-	if rawStr == nil {
-		return nil, ErrInitiatorRequired
-	}
-	initiator, ierr = base64.StdEncoding.DecodeString(string(*rawStr))
+	initiator, ierr = Initiator(sdp)
 	if ierr != nil {
 		return
 	}
+	if initiator == nil {
+		return nil, ErrInitiatorRequired
+	}
+	if ep.Options.identity() {
+		ep.Options.PeerKey, ierr = verifyIdentity(ep.Options.PrivateKey, ep.Options.TrustedKeys, roleOffer, sdp, remoteEnvelope(sdp))
+		if ierr != nil {
+			return
+		}
+	}
+	ep.setCapabilities(Intersect(ep.Options.Capabilities, remoteCapabilities(sdp)))
+	if HasCapability(ep.Capabilities(), CapabilityReliability) {
+		var r Reliability
+		r, ep.Options.Lifetime, ierr = parseReliability(remoteEnvelope(sdp).Extensions)
+		if ierr != nil {
+			return
+		}
+		ep.Options.Reliability = r
+		ep.setReliability(r)
+	}
+	// the outbound side chooses the transport, peers without the rtp capability never ask for it
+	ep.Options.Transport = TransportDataChannel
+	if HasCapability(ep.Capabilities(), CapabilityRTP) {
+		ep.Options.Transport, ierr = parseTransport(remoteEnvelope(sdp).Extensions)
+		if ierr != nil {
+			return
+		}
+	}
 	return initiator, nil
 }
 
 func (ep *Inbound) HandleConnect(buf []byte) (ierr error) {
+	// the session is dead then, the closed peer connection lets the outbound reconnect
 	defer then(&ierr, nil, func() {
 		ep.sess.Reject(ierr)
+		ep.pc.Close()
 	})
+	// registered after then, so the session is rejected with the wrapped error
+	phase := PhaseSetup
+	defer func() {
+		ierr = NewError(phase, ep.peer(), ierr)
+		if ierr != nil {
+			return
+		}
+	}()
 
 	pc := ep.pc
-	pc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
-		switch pcs {
-		case webrtc.PeerConnectionStateDisconnected:
-			pc.Close()
-		}
-	})
+	timeouts := ep.Options.Timeouts.WithDefaults()
 
 	ierr = pc.SetRemoteDescription(ep.sess.Description())
-	if ierr != nil {
+	if ierr !=
+	// the track is added after the offer is applied, so it is bound to the transceiver of peer
+	nil {
 		return
 	}
+
+	if ep.Options.Transport == TransportRTP {
+		ierr = ep.addTrack(pc)
+		if ierr != nil {
+			return
+		}
+	}
 	answer, ierr := pc.CreateAnswer(nil)
 	if ierr != nil {
 		return
 	}
+	phase = PhaseGather
 	gatherComplete := webrtc.GatheringCompletePromise(pc)
 	ierr = pc.SetLocalDescription(answer)
 	if ierr != nil {
 		return
 	}
-	<-gatherComplete
+	_, ierr = await(PhaseGather, timeouts.Gather, gatherComplete)
+	if ierr != nil {
+		return
+	}
 	roffer := pc.LocalDescription()
+	phase = PhaseSetup
 
-	responder := sdp.Information(base64.StdEncoding.EncodeToString(buf))
 	sdp, ierr := roffer.Unmarshal()
 	if ierr != nil {
 		return
 	}
-	sdp.SessionInformation = &responder
+	FilterCandidates(sdp, ep.Options.CandidateTypes)
+	env := Envelope{Message: buf, Capabilities: ep.Capabilities()}
+	// the answer confirms the reliability and transport chosen by the outbound side
+	if HasCapability(env.Capabilities, CapabilityReliability) {
+		env.Extensions = ep.Options.extensions()
+	}
+	if ep.Options.identity() {
+		var identity map[string]string
+		identity, ierr = signIdentity(ep.Options.PrivateKey, ep.Options.PeerKey, roleAnswer, sdp, buf)
+		if ierr != nil {
+			return
+		}
+		env.Extensions = mergeExtensions(env.Extensions, identity)
+	}
+	SetEnvelope(sdp, env)
 	rsdp, ierr := sdp.Marshal()
 	if ierr != nil {
 		return
 	}
 	roffer.SDP = string(rsdp)
 
+	// the handler is set before the answer is sent, so no DataChannel is missed
+	opened := make(chan struct{})
+	var once sync.Once
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() == ControlLabel && HasCapability(ep.Capabilities(), CapabilityControl) {
+			ep.setControl(dc)
+			return
+		}
+		if dc.Label() == ProbeLabel && HasCapability(ep.Capabilities(), CapabilityMTU) {
+			ep.setProbe(dc, ep.MTU)
+			return
+		}
+		switch i := channelIndex(dc.Label()); {
+		case i == 0:
+			ep.setChannel(i, dc)
+			once.Do(func() { close(opened) })
+		case i > 0 && HasCapability(ep.Capabilities(), CapabilityChannels):
+			ep.setChannel(i, dc)
+		}
+	})
+
+	phase = PhaseSignaling
 	ierr = ep.sess.Resolve(roffer)
 	if ierr != nil {
 		return
 	}
+	phase = PhaseICE
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	ctx, cause := context.WithCancelCause(context.Background())
-	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
-		switch dc.Label() {
-		case "wgortc":
-			defer cause(nil)
-			ep.dc = dc
-			dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-				ep.ch <- msg.Data
-			})
-		}
-	})
-	<-ctx.Done()
-	if err := context.Cause(ctx); err != context.Canceled {
-		ierr = err
+	if ep.Options.Transport == TransportRTP {
+		ierr = ep.wait(pc, nil, timeouts)
 		if ierr != nil {
 			return
 		}
+		ep.enable(ep.Options, ep.Capabilities(), ep.MTU())
+		return
 	}
 
+	ierr = asTimeout(PhaseICE, timeouts.ICE, WaitICE(pc, timeouts.ICE))
+	if ierr != nil {
+		return
+	}
+	_, ierr = await(PhaseDataChannel, timeouts.DataChannel, opened)
+	if ierr != nil {
+		return
+	}
+	ep.enable(ep.Options, ep.Capabilities(), ep.MTU())
+
 	return
 }
 
-func (ep *Inbound) Message() (ch <-chan []byte) {
-	return ep.ch
+// peer is the verified wireguard public key, empty without identity
+func (ep *Inbound) peer() string {
+	if ep.Options.PeerKey.IsZero() {
+		return ""
+	}
+	return ep.Options.PeerKey.String()
+}
+
+// Done is closed once the peer connection is failed or closed
+func (ep *Inbound) Done() <-chan struct{} {
+	return ep.done
+}
+
+func (ep *Inbound) Close() error {
+	return ep.pc.Close()
 }
 
 var ErrInitiatorRequired = errors.New("first message initiator is required in webrtc sdp SessionInformation")
 
+// MTU is the largest wireguard packet sent in one sctp chunk of the selected candidate pair,
+// lowered to the largest probe acked by the peer. the tun mtu could be sized as MTU() - WireguardOverhead
+func (ep *Inbound) MTU() int {
+	return ep.mtu(pcMTU(ep.pc, ep.Options.LinkMTU, ep.Options.Transport))
+}
+
 func (ep *Inbound) DstToString() string {
 	return getPCRemote(ep.pc)
 }
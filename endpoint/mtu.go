@@ -0,0 +1,213 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// pion can't set the DF bit nor read icmp, so the upper bound of path mtu is computed from the link mtu
+// and the overhead of the selected candidate pair, then it is lowered to the largest probe which the peer acks
+const (
+	// DefaultLinkMTU is used when Options.LinkMTU is zero
+	DefaultLinkMTU = 1500
+	// MinLinkMTU is the ipv6 minimum mtu
+	MinLinkMTU = 1280
+	// MaxLinkMTU is a jumbo frame
+	MaxLinkMTU = 9000
+
+	// WireguardOverhead is the transport message header and tag, tun mtu should be MTU() - WireguardOverhead
+	WireguardOverhead = 32
+
+	// pion sctp association mtu, it is the payload of a dtls record
+	sctpMTU = 1228
+	// sctp common header and data chunk header
+	sctpOverhead = 12 + 16
+	// dtls record header, explicit nonce and aes gcm tag
+	dtlsOverhead = 13 + 8 + 16
+	udpOverhead  = 8
+	ipv4Overhead = 20
+	ipv6Overhead = 40
+	// turn send indication with xor-peer-address and data attribute, channel data is smaller
+	turnOverhead = 20 + 24 + 4
+)
+
+// PathMTU returns the largest wireguard packet which is sent in one sctp chunk,
+// larger packets are split by sctp and lost together on lossy DataChannels
+func PathMTU(linkMTU int, ipv6, relay bool) int {
+	if linkMTU == 0 {
+		linkMTU = DefaultLinkMTU
+	}
+	ip := ipv4Overhead
+	if ipv6 {
+		ip = ipv6Overhead
+	}
+	mtu := linkMTU - ip - udpOverhead - dtlsOverhead - sctpOverhead
+	if relay {
+		mtu -= turnOverhead
+	}
+	if max := sctpMTU - sctpOverhead; mtu > max {
+		mtu = max
+	}
+	return mtu
+}
+
+// CapabilityMTU means the peer acks the probes on the ProbeLabel DataChannel
+const CapabilityMTU Capability = "mtu"
+
+// ProbeLabel is the DataChannel label of mtu probes, it is unordered without retransmits,
+// so a probe larger than the path is lost instead of being resent
+const ProbeLabel = Label + "-probe"
+
+const (
+	mtuProbeType = 0xf0
+	mtuAckType   = 0xf1
+	// type and size
+	mtuHeaderSize = 1 + 2
+
+	// mtuProbeStep is the size difference of probes, down to the path mtu of MinLinkMTU over ipv6 and turn
+	mtuProbeStep = 16
+	// probes are sent again in rounds, so a randomly lost one doesn't lower the mtu
+	mtuProbeRounds   = 3
+	mtuProbeInterval = time.Second
+)
+
+// newMTUProbe is a zero padded probe of size
+func newMTUProbe(size int) []byte {
+	probe := make([]byte, size)
+	probe[0] = mtuProbeType
+	binary.BigEndian.PutUint16(probe[1:], uint16(size))
+	return probe
+}
+
+func isMTUProbe(msg []byte) bool {
+	return len(msg) >= mtuHeaderSize && msg[0] == mtuProbeType && int(binary.BigEndian.Uint16(msg[1:])) == len(msg)
+}
+
+func newMTUAck(size int) []byte {
+	return binary.BigEndian.AppendUint16([]byte{mtuAckType}, uint16(size))
+}
+
+// mtuAckSize returns the size of the acked probe, zero if msg isn't an ack
+func mtuAckSize(msg []byte) int {
+	if len(msg) != mtuHeaderSize || msg[0] != mtuAckType {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(msg[1:]))
+}
+
+// mtuProbeSizes returns the sizes of probes from upper down to the smallest path mtu
+func mtuProbeSizes(upper int) (sizes []int) {
+	lower := PathMTU(MinLinkMTU, true, true)
+	for size := upper; size >= lower; size -= mtuProbeStep {
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		sizes = append(sizes, upper)
+	}
+	return
+}
+
+// setProbe acks the probes of peer on dc, and probes the path once dc is open.
+// mtu returns the computed upper bound, it is read at open when the candidate pair is selected
+func (t *transport) setProbe(dc *webrtc.DataChannel, mtu func() int) {
+	gen := t.gen.Load()
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if isMTUProbe(msg.Data) {
+			dc.Send(newMTUAck(len(msg.Data)))
+			return
+		}
+		if size := mtuAckSize(msg.Data); size > 0 && t.gen.Load() == gen {
+			t.probed(size)
+		}
+	})
+	dc.OnOpen(func() { go t.probeMTU(dc, mtuProbeSizes(mtu())) })
+}
+
+// probeMTU sends probes of decreasing size until the largest one is acked
+func (t *transport) probeMTU(dc *webrtc.DataChannel, sizes []int) {
+	for i := 0; i < mtuProbeRounds; i++ {
+		if i > 0 {
+			time.Sleep(mtuProbeInterval)
+		}
+		if int(t.probedMTU.Load()) >= sizes[0] {
+			return
+		}
+		for _, size := range sizes {
+			if dc.Send(newMTUProbe(size)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// probed raises the probed mtu to the acked size, the fragments follow it
+func (t *transport) probed(size int) {
+	for {
+		old := t.probedMTU.Load()
+		if int(old) >= size {
+			return
+		}
+		if t.probedMTU.CompareAndSwap(old, int32(size)) {
+			break
+		}
+	}
+	if t.fragmentSize.Load() > 0 {
+		if Padding(t.padding.Load()) != PaddingNone {
+			size -= paddedHeaderSize
+		}
+		t.setFragmentSize(size)
+	}
+}
+
+// mtu lowers the computed path mtu to the probed one
+func (t *transport) mtu(computed int) int {
+	if probed := int(t.probedMTU.Load()); probed > 0 && probed < computed {
+		return probed
+	}
+	return computed
+}
+
+// pcMTU computes the path mtu of the selected candidate pair, it assumes ipv4 without relay before connected
+func pcMTU(pc *webrtc.PeerConnection, linkMTU int, t Transport) int {
+	pathMTU := PathMTU
+	if t == TransportRTP {
+		pathMTU = RTPPathMTU
+	}
+	pair := selectedPair(pc)
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return pathMTU(linkMTU, false, false)
+	}
+	relay := pair.Local.Typ == webrtc.ICECandidateTypeRelay || pair.Remote.Typ == webrtc.ICECandidateTypeRelay
+	return pathMTU(linkMTU, isIPv6(pair.Local.Address) || isIPv6(pair.Remote.Address), relay)
+}
+
+func isIPv6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && !addr.Unmap().Is4()
+}
+
+func selectedPair(pc *webrtc.PeerConnection) *webrtc.ICECandidatePair {
+	if pc == nil {
+		return nil
+	}
+	sctp := pc.SCTP()
+	if sctp == nil {
+		return nil
+	}
+	dtls := sctp.Transport()
+	if dtls == nil {
+		return nil
+	}
+	ice := dtls.ICETransport()
+	if ice == nil {
+		return nil
+	}
+	pair, err := ice.GetSelectedCandidatePair()
+	if err != nil {
+		return nil
+	}
+	return pair
+}
@@ -0,0 +1,49 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+)
+
+func TestPathMTU(t *testing.T) {
+	// sctp doesn't send chunks larger than its own mtu
+	assert.Equal(PathMTU(0, false, false), sctpMTU-sctpOverhead)
+	assert.Equal(PathMTU(MaxLinkMTU, true, true), sctpMTU-sctpOverhead)
+
+	assert.Equal(PathMTU(MinLinkMTU, false, false), 1280-20-8-37-28)
+	assert.Equal(PathMTU(MinLinkMTU, true, false), 1280-40-8-37-28)
+	assert.Equal(PathMTU(MinLinkMTU, true, true), 1280-40-8-37-28-48)
+
+	assert.Equal(pcMTU(nil, MinLinkMTU, TransportDataChannel), PathMTU(MinLinkMTU, false, false))
+
+	assert.Equal(RTPPathMTU(0, false, false), 1500-20-8-22)
+	assert.Equal(pcMTU(nil, 0, TransportRTP), RTPPathMTU(0, false, false))
+	assert.That(isIPv6("::1"))
+	assert.That(!isIPv6("::ffff:127.0.0.1"))
+	assert.That(!isIPv6("host.local"))
+}
+
+func TestMTUProbe(t *testing.T) {
+	probe := newMTUProbe(1200)
+	assert.Equal(len(probe), 1200)
+	assert.That(isMTUProbe(probe))
+	assert.That(!isMTUProbe(probe[:1199]))
+	assert.Equal(mtuAckSize(newMTUAck(len(probe))), 1200)
+	assert.Equal(mtuAckSize(probe[:mtuHeaderSize]), 0)
+
+	sizes := mtuProbeSizes(1200)
+	assert.Equal(sizes[0], 1200)
+	assert.That(sizes[len(sizes)-1] >= PathMTU(MinLinkMTU, true, true))
+	assert.DeepEqual(mtuProbeSizes(1000), []int{1000})
+
+	// the largest ack wins, fragments follow it without the padding header
+	tr := newTransport()
+	tr.setFragmentSize(1200)
+	tr.setPadding(PaddingBucket)
+	tr.probed(1152)
+	tr.probed(1120)
+	assert.Equal(tr.mtu(1200), 1152)
+	assert.Equal(tr.mtu(1000), 1000)
+	assert.Equal(int(tr.fragmentSize.Load()), 1152-paddedHeaderSize)
+}
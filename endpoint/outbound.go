@@ -3,12 +3,9 @@
 package endpoint
 
 import (
-	"encoding/base64"
 	"errors"
 	"net"
-	"time"
 
-	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/shynome/wgortc/signaler"
 	"golang.zx2c4.com/wireguard/conn"
@@ -16,10 +13,16 @@ import (
 
 type Outbound struct {
 	baseEndpoint
+	transport
+	Options Options
+
 	pc  *webrtc.PeerConnection
-	dc  *webrtc.DataChannel
 	hub Hub
-	ch  chan []byte
+
+	// relay is used when ice failed and the signaler supports relay,
+	// the inbound side closes its peer connection after the ice timeout,
+	// so the DataChannel is only retried by the next handshake
+	relay signaler.Relay
 }
 
 var (
@@ -28,46 +31,50 @@ var (
 )
 
 type Hub interface {
-	NewPeerConnection() (*webrtc.PeerConnection, error)
-	signaler.Channel
+	NewPeerConnection(opts Options) (*webrtc.PeerConnection, error)
+	Signaler(name string) (signaler.Channel, error)
 }
 
 func NewOutbound(id string, hub Hub) *Outbound {
-	return &Outbound{
+	ep := &Outbound{
 		baseEndpoint: baseEndpoint{id: id},
+		transport:    newTransport(),
 
 		hub: hub,
-		ch:  make(chan []byte),
 	}
+	ep.onError = func(err error) { ep.Options.report(PhaseSend, id, err) }
+	return ep
 }
 
 func (ep *Outbound) Send(buf []byte) (err error) {
 	closed := ep.dcIsClosed()
 	if buf[0] == 1 && closed {
-		go ep.Connect(buf)
+		// wireguard reuses buf once Send returns
+		buf = append([]byte(nil), buf...)
+		go func() { ep.Options.report(PhaseSetup, ep.id, ep.Connect(buf)) }()
 		return
 	}
 	if closed {
+		if relay := ep.relay; relay != nil {
+			return relay.Relay(ep.id, buf)
+		}
 		return net.ErrClosed
 	}
-	go ep.dc.Send(buf)
+	ep.send(buf)
 	return
 }
 
-func (ep *Outbound) dcIsClosed() bool {
-	if ep.dc == nil {
-		return true
-	}
-	return ep.dc.ReadyState() != webrtc.DataChannelStateOpen
-}
-
 func (ep *Outbound) Connect(buf []byte) (ierr error) {
+	phase := PhaseSetup
+	defer func() { ierr = NewError(phase, ep.id, ierr) }()
+
 	var pc *webrtc.PeerConnection = ep.pc
 	if pc != nil {
 		pc.Close()
 	}
 
-	pc, ierr = ep.hub.NewPeerConnection()
+	timeouts := ep.Options.Timeouts.WithDefaults()
+	pc, ierr = ep.hub.NewPeerConnection(ep.Options)
 	ep.pc = pc
 
 	pc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
@@ -77,40 +84,96 @@ func (ep *Outbound) Connect(buf []byte) (ierr error) {
 		}
 	})
 
-	dcinit := webrtc.DataChannelInit{
-		Ordered:        refVal(false),
-		MaxRetransmits: refVal(uint16(0)),
+	dcinit := ep.Options.dataChannelInit()
+	ep.reset()
+	ep.setReliability(ep.Options.Reliability)
+	var dc *webrtc.DataChannel
+	if ep.Options.Transport == TransportRTP {
+		ierr = ep.addTrack(pc)
+	} else {
+		dc, ierr = pc.CreateDataChannel(Label, dcinit)
+		ep.setChannel(0, dc)
 	}
-	dc, ierr := pc.CreateDataChannel("wgortc", &dcinit)
-	ep.dc = dc
-
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		ep.ch <- msg.Data
-	})
 
+	phase = PhaseGather
 	gatherComplete := webrtc.GatheringCompletePromise(pc)
 	offer, ierr := pc.CreateOffer(nil)
 	ierr = pc.SetLocalDescription(offer)
-	<-gatherComplete
+	_, ierr = await(PhaseGather, timeouts.Gather, gatherComplete)
 	offer = *pc.LocalDescription()
 
-	initiator := sdp.Information(base64.StdEncoding.EncodeToString(buf))
+	phase = PhaseSetup
+
 	sdp, ierr := offer.Unmarshal()
-	sdp.SessionInformation = &initiator
+	FilterCandidates(sdp, ep.Options.CandidateTypes)
+	exts := ep.Options.extensions()
+	if ep.Options.identity() {
+		if ep.Options.PeerKey.IsZero() {
+			return ErrPeerKeyRequired
+		}
+		var identity map[string]string
+		identity, ierr = signIdentity(ep.Options.PrivateKey, ep.Options.PeerKey, roleOffer, sdp, buf)
+		exts = mergeExtensions(exts, identity)
+	}
+	SetEnvelope(sdp, Envelope{
+		Message:      buf,
+		Capabilities: ep.Options.Capabilities,
+		Extensions:   exts,
+	})
 	rsdp, ierr := sdp.Marshal()
 	offer.SDP = string(rsdp)
 
-	anwser, ierr := ep.hub.Handshake(ep.id, offer)
+	sig, ierr := ep.hub.Signaler(ep.Options.Signaler)
+	phase = PhaseSignaling
+	anwser, ierr := handshake(sig, ep.id, offer, timeouts.Signaling)
+
+	phase = PhaseVerify
+	sdp2, ierr := anwser.Unmarshal()
+	ierr = VerifyFingerprints(sdp2, ep.Options.Fingerprints)
+	if ep.Options.identity() {
+		_, ierr = verifyIdentity(ep.Options.PrivateKey, []Key{ep.Options.PeerKey}, roleAnswer, sdp2, remoteEnvelope(sdp2))
+	}
 
 	ierr = pc.SetRemoteDescription(*anwser)
 
-	sdp2, ierr := anwser.Unmarshal()
-	if sdp2.SessionInformation == nil {
+	responder, ierr := Responder(sdp2)
+	if responder == nil {
 		return ErrInitiatorResponderRequired
 	}
-	responder, ierr := base64.StdEncoding.DecodeString(string(*sdp2.SessionInformation))
+	ep.setCapabilities(Intersect(ep.Options.Capabilities, remoteCapabilities(sdp2)))
+	if ep.Options.Transport == TransportRTP && !HasCapability(ep.Capabilities(), CapabilityRTP) {
+		return ErrRTPUnsupported
+	}
 
-	ierr = WaitDC(dc, 5*time.Second)
+	phase = PhaseICE
+	if err := ep.wait(pc, dc, timeouts); err != nil {
+		relay, ok := sig.(signaler.Relay)
+		if !ok {
+			return err
+		}
+		ep.relay = relay
+	} else {
+		ep.enable(ep.Options, ep.Capabilities(), ep.MTU())
+	}
+	phase = PhaseSetup
+	// extra channels are negotiated in band, the first one has opened the sctp association
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityControl) {
+		var dc *webrtc.DataChannel
+		dc, ierr = pc.CreateDataChannel(ControlLabel, nil)
+		ep.setControl(dc)
+	}
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityMTU) {
+		var dc *webrtc.DataChannel
+		dc, ierr = pc.CreateDataChannel(ProbeLabel, &webrtc.DataChannelInit{Ordered: refVal(false), MaxRetransmits: refVal(uint16(0))})
+		ep.setProbe(dc, ep.MTU)
+	}
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityChannels) {
+		for i := 1; i < ep.Options.Channels; i++ {
+			var dc *webrtc.DataChannel
+			dc, ierr = pc.CreateDataChannel(channelLabel(i), dcinit)
+			ep.setChannel(i, dc)
+		}
+	}
 	ep.ch <- responder
 
 	return
@@ -127,8 +190,10 @@ func (ep *Outbound) Close() (err error) {
 	return
 }
 
-func (ep *Outbound) Message() (ch <-chan []byte) {
-	return ep.ch
+// MTU is the largest wireguard packet sent in one sctp chunk of the selected candidate pair,
+// lowered to the largest probe acked by the peer. the tun mtu could be sized as MTU() - WireguardOverhead
+func (ep *Outbound) MTU() int {
+	return ep.mtu(pcMTU(ep.pc, ep.Options.LinkMTU, ep.Options.Transport))
 }
 
 func (ep *Outbound) DstToString() string {
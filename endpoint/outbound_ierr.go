@@ -5,12 +5,9 @@
 package endpoint
 
 import (
-	"encoding/base64"
 	"errors"
 	"net"
-	"time"
 
-	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/shynome/wgortc/signaler"
 	"golang.zx2c4.com/wireguard/conn"
@@ -18,10 +15,16 @@ import (
 
 type Outbound struct {
 	baseEndpoint
+	transport
+	Options	Options
+
 	pc	*webrtc.PeerConnection
-	dc	*webrtc.DataChannel
 	hub	Hub
-	ch	chan []byte
+
+	// relay is used when ice failed and the signaler supports relay,
+	// the inbound side closes its peer connection after the ice timeout,
+	// so the DataChannel is only retried by the next handshake
+	relay	signaler.Relay
 }
 
 var (
@@ -30,46 +33,55 @@ var (
 )
 
 type Hub interface {
-	NewPeerConnection() (*webrtc.PeerConnection, error)
-	signaler.Channel
+	NewPeerConnection(opts Options) (*webrtc.PeerConnection, error)
+	Signaler(name string) (signaler.Channel, error)
 }
 
 func NewOutbound(id string, hub Hub) *Outbound {
-	return &Outbound{
+	ep := &Outbound{
 		baseEndpoint:	baseEndpoint{id: id},
+		transport:	newTransport(),
 
 		hub:	hub,
-		ch:	make(chan []byte),
 	}
+	ep.onError = func(err error) { ep.Options.report(PhaseSend, id, err) }
+	return ep
 }
 
 func (ep *Outbound) Send(buf []byte) (err error) {
 	closed := ep.dcIsClosed()
 	if buf[0] == 1 && closed {
-		go ep.Connect(buf)
+		// wireguard reuses buf once Send returns
+		buf = append([]byte(nil), buf...)
+		go func() { ep.Options.report(PhaseSetup, ep.id, ep.Connect(buf)) }()
 		return
 	}
 	if closed {
+		if relay := ep.relay; relay != nil {
+			return relay.Relay(ep.id, buf)
+		}
 		return net.ErrClosed
 	}
-	go ep.dc.Send(buf)
+	ep.send(buf)
 	return
 }
 
-func (ep *Outbound) dcIsClosed() bool {
-	if ep.dc == nil {
-		return true
-	}
-	return ep.dc.ReadyState() != webrtc.DataChannelStateOpen
-}
-
 func (ep *Outbound) Connect(buf []byte) (ierr error) {
+	phase := PhaseSetup
+	defer func() {
+		ierr = NewError(phase, ep.id, ierr)
+		if ierr != nil {
+			return
+		}
+	}()
+
 	var pc *webrtc.PeerConnection = ep.pc
 	if pc != nil {
 		pc.Close()
 	}
 
-	pc, ierr = ep.hub.NewPeerConnection()
+	timeouts := ep.Options.Timeouts.WithDefaults()
+	pc, ierr = ep.hub.NewPeerConnection(ep.Options)
 	if ierr != nil {
 		return
 	}
@@ -82,20 +94,24 @@ func (ep *Outbound) Connect(buf []byte) (ierr error) {
 		}
 	})
 
-	dcinit := webrtc.DataChannelInit{
-		Ordered:	refVal(false),
-		MaxRetransmits:	refVal(uint16(0)),
-	}
-	dc, ierr := pc.CreateDataChannel("wgortc", &dcinit)
-	if ierr != nil {
-		return
+	dcinit := ep.Options.dataChannelInit()
+	ep.reset()
+	ep.setReliability(ep.Options.Reliability)
+	var dc *webrtc.DataChannel
+	if ep.Options.Transport == TransportRTP {
+		ierr = ep.addTrack(pc)
+		if ierr != nil {
+			return
+		}
+	} else {
+		dc, ierr = pc.CreateDataChannel(Label, dcinit)
+		if ierr != nil {
+			return
+		}
+		ep.setChannel(0, dc)
 	}
-	ep.dc = dc
-
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		ep.ch <- msg.Data
-	})
 
+	phase = PhaseGather
 	gatherComplete := webrtc.GatheringCompletePromise(pc)
 	offer, ierr := pc.CreateOffer(nil)
 	if ierr != nil {
@@ -105,47 +121,123 @@ func (ep *Outbound) Connect(buf []byte) (ierr error) {
 	if ierr != nil {
 		return
 	}
-	<-gatherComplete
+	_, ierr = await(PhaseGather, timeouts.Gather, gatherComplete)
+	if ierr != nil {
+		return
+	}
 	offer = *pc.LocalDescription()
 
-	initiator := sdp.Information(base64.StdEncoding.EncodeToString(buf))
+	phase = PhaseSetup
+
 	sdp, ierr := offer.Unmarshal()
 	if ierr != nil {
 		return
 	}
-	sdp.SessionInformation = &initiator
+	FilterCandidates(sdp, ep.Options.CandidateTypes)
+	exts := ep.Options.extensions()
+	if ep.Options.identity() {
+		if ep.Options.PeerKey.IsZero() {
+			return ErrPeerKeyRequired
+		}
+		var identity map[string]string
+		identity, ierr = signIdentity(ep.Options.PrivateKey, ep.Options.PeerKey, roleOffer, sdp, buf)
+		if ierr != nil {
+			return
+		}
+		exts = mergeExtensions(exts, identity)
+	}
+	SetEnvelope(sdp, Envelope{
+		Message:	buf,
+		Capabilities:	ep.Options.Capabilities,
+		Extensions:	exts,
+	})
 	rsdp, ierr := sdp.Marshal()
 	if ierr != nil {
 		return
 	}
 	offer.SDP = string(rsdp)
 
-	anwser, ierr := ep.hub.Handshake(ep.id, offer)
+	sig, ierr := ep.hub.Signaler(ep.Options.Signaler)
 	if ierr != nil {
 		return
 	}
-
-	ierr = pc.SetRemoteDescription(*anwser)
+	phase = PhaseSignaling
+	anwser, ierr := handshake(sig, ep.id, offer, timeouts.Signaling)
 	if ierr != nil {
 		return
 	}
 
+	phase = PhaseVerify
 	sdp2, ierr := anwser.Unmarshal()
 	if ierr != nil {
 		return
 	}
-	if sdp2.SessionInformation == nil {
-		return ErrInitiatorResponderRequired
+	ierr = VerifyFingerprints(sdp2, ep.Options.Fingerprints)
+	if ierr != nil {
+		return
 	}
-	responder, ierr := base64.StdEncoding.DecodeString(string(*sdp2.SessionInformation))
+	if ep.Options.identity() {
+		_, ierr = verifyIdentity(ep.Options.PrivateKey, []Key{ep.Options.PeerKey}, roleAnswer, sdp2, remoteEnvelope(sdp2))
+		if ierr != nil {
+			return
+		}
+	}
+
+	ierr = pc.SetRemoteDescription(*anwser)
 	if ierr != nil {
 		return
 	}
 
-	ierr = WaitDC(dc, 5*time.Second)
+	responder, ierr := Responder(sdp2)
 	if ierr != nil {
 		return
 	}
+	if responder == nil {
+		return ErrInitiatorResponderRequired
+	}
+	ep.setCapabilities(Intersect(ep.Options.Capabilities, remoteCapabilities(sdp2)))
+	if ep.Options.Transport == TransportRTP && !HasCapability(ep.Capabilities(), CapabilityRTP) {
+		return ErrRTPUnsupported
+	}
+
+	phase = PhaseICE
+	if err := ep.wait(pc, dc, timeouts); err != nil {
+		relay, ok := sig.(signaler.Relay)
+		if !ok {
+			return err
+		}
+		ep.relay = relay
+	} else {
+		ep.enable(ep.Options, ep.Capabilities(), ep.MTU())
+	}
+	phase = PhaseSetup
+	// extra channels are negotiated in band, the first one has opened the sctp association
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityControl) {
+		var dc *webrtc.DataChannel
+		dc, ierr = pc.CreateDataChannel(ControlLabel, nil)
+		if ierr != nil {
+			return
+		}
+		ep.setControl(dc)
+	}
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityMTU) {
+		var dc *webrtc.DataChannel
+		dc, ierr = pc.CreateDataChannel(ProbeLabel, &webrtc.DataChannelInit{Ordered: refVal(false), MaxRetransmits: refVal(uint16(0))})
+		if ierr != nil {
+			return
+		}
+		ep.setProbe(dc, ep.MTU)
+	}
+	if dc != nil && HasCapability(ep.Capabilities(), CapabilityChannels) {
+		for i := 1; i < ep.Options.Channels; i++ {
+			var dc *webrtc.DataChannel
+			dc, ierr = pc.CreateDataChannel(channelLabel(i), dcinit)
+			if ierr != nil {
+				return
+			}
+			ep.setChannel(i, dc)
+		}
+	}
 	ep.ch <- responder
 
 	return
@@ -162,8 +254,10 @@ func (ep *Outbound) Close() (err error) {
 	return
 }
 
-func (ep *Outbound) Message() (ch <-chan []byte) {
-	return ep.ch
+// MTU is the largest wireguard packet sent in one sctp chunk of the selected candidate pair,
+// lowered to the largest probe acked by the peer. the tun mtu could be sized as MTU() - WireguardOverhead
+func (ep *Outbound) MTU() int {
+	return ep.mtu(pcMTU(ep.pc, ep.Options.LinkMTU, ep.Options.Transport))
 }
 
 func (ep *Outbound) DstToString() string {
@@ -0,0 +1,121 @@
+package endpoint
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mrand "math/rand"
+	"time"
+)
+
+// Padding hides the sizes of wireguard packets, the peer strips it before handing packets to wireguard
+type Padding int
+
+const (
+	PaddingNone Padding = iota
+	// PaddingRandom appends 0 to MaxPadding random bytes
+	PaddingRandom
+	// PaddingBucket pads packets up to the next bucket size
+	PaddingBucket
+)
+
+// CapabilityPadding means the peer strips padding and drops cover traffic
+const CapabilityPadding Capability = "padding"
+
+const (
+	// paddedType frames are [type, payload length, payload, padding],
+	// frames with empty payload are cover traffic
+	paddedType       = 0xfd
+	paddedHeaderSize = 1 + 2
+
+	MaxPadding = 255
+	// padded frames don't grow over one sctp chunk
+	maxPaddedSize = sctpMTU - sctpOverhead
+)
+
+var paddingBuckets = []int{128, 256, 512, 768, 1024, maxPaddedSize}
+
+var paddingNames = map[Padding]string{
+	PaddingNone:   "none",
+	PaddingRandom: "random",
+	PaddingBucket: "bucket",
+}
+
+func (p Padding) String() string {
+	if s, ok := paddingNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("Padding(%d)", int(p))
+}
+
+func ParsePadding(s string) (Padding, error) {
+	for p, name := range paddingNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown padding %q", s)
+}
+
+// pad frames buf with padding, the padding bytes are random so they don't compress
+func pad(buf []byte, p Padding) []byte {
+	size := paddedHeaderSize + len(buf)
+	switch p {
+	case PaddingRandom:
+		size += mrand.Intn(MaxPadding + 1)
+	case PaddingBucket:
+		for _, b := range paddingBuckets {
+			if b >= size {
+				size = b
+				break
+			}
+		}
+	}
+	if size > maxPaddedSize {
+		size = maxPaddedSize
+	}
+	if min := paddedHeaderSize + len(buf); size < min {
+		size = min
+	}
+	frame := make([]byte, size)
+	frame[0] = paddedType
+	binary.BigEndian.PutUint16(frame[1:], uint16(len(buf)))
+	n := copy(frame[paddedHeaderSize:], buf)
+	rand.Read(frame[paddedHeaderSize+n:])
+	return frame
+}
+
+// unpad returns nil for cover traffic and invalid frames
+func unpad(frame []byte) []byte {
+	if len(frame) < paddedHeaderSize {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(frame[1:]))
+	if n == 0 || paddedHeaderSize+n > len(frame) {
+		return nil
+	}
+	return frame[paddedHeaderSize : paddedHeaderSize+n]
+}
+
+func isPadded(buf []byte) bool {
+	return len(buf) > 0 && buf[0] == paddedType
+}
+
+// cover sends a padded frame without payload every interval over data DataChannels,
+// it stops once the DataChannels are replaced or closed
+func (t *transport) cover(interval time.Duration, p Padding) {
+	gen := t.gen.Load()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if t.gen.Load() != gen || t.dcIsClosed() {
+			return
+		}
+		if p == PaddingNone {
+			p = PaddingRandom
+		}
+		t.locker.RLock()
+		t.sendData(pad(nil, p))
+		t.locker.RUnlock()
+	}
+}
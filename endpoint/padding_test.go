@@ -0,0 +1,35 @@
+package endpoint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lainio/err2/assert"
+)
+
+func TestPad(t *testing.T) {
+	keepalive := newMessage(messageTransportType, messageKeepaliveSize)
+
+	frame := pad(keepalive, PaddingBucket)
+	assert.Equal(len(frame), paddingBuckets[0])
+	assert.That(isPadded(frame))
+	assert.That(bytes.Equal(unpad(frame), keepalive))
+
+	frame = pad(newMessage(messageTransportType, 1000), PaddingBucket)
+	assert.Equal(len(frame), 1024)
+
+	// padding doesn't grow over one sctp chunk
+	frame = pad(newMessage(messageTransportType, 1452), PaddingBucket)
+	assert.Equal(len(frame), paddedHeaderSize+1452)
+
+	for i := 0; i < 100; i++ {
+		frame = pad(keepalive, PaddingRandom)
+		assert.That(len(frame) >= paddedHeaderSize+len(keepalive) && len(frame) <= paddedHeaderSize+len(keepalive)+MaxPadding)
+		assert.That(bytes.Equal(unpad(frame), keepalive))
+	}
+
+	// cover traffic and invalid frames are dropped
+	assert.SLen(unpad(pad(nil, PaddingRandom)), 0)
+	assert.SLen(unpad([]byte{paddedType, 0}), 0)
+	assert.SLen(unpad([]byte{paddedType, 0, 9, 1}), 0)
+}
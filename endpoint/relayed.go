@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+	"github.com/shynome/wgortc/signaler"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// Relayed is the endpoint of a peer which is reached through signaler relay
+type Relayed struct {
+	baseEndpoint
+	relay signaler.Relay
+}
+
+var (
+	_ conn.Endpoint = (*Relayed)(nil)
+	_ Sender        = (*Relayed)(nil)
+)
+
+func NewRelayed(id string, relay signaler.Relay) *Relayed {
+	return &Relayed{
+		baseEndpoint: baseEndpoint{id: id},
+		relay:        relay,
+	}
+}
+
+func (ep *Relayed) Send(buf []byte) error {
+	return ep.relay.Relay(ep.id, buf)
+}
@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Reliability is the delivery mode of data DataChannels, it is chosen by the outbound side
+// and carried to the inbound side by the DataChannel open message and the envelope
+type Reliability int
+
+const (
+	// ReliabilityUnreliable never retransmits, like udp, it is the default
+	ReliabilityUnreliable Reliability = iota
+	// ReliabilityPartial retransmits within Options.Lifetime
+	ReliabilityPartial
+	// ReliabilityReliable retransmits until delivered in order
+	ReliabilityReliable
+)
+
+// DefaultLifetime is used by ReliabilityPartial when Options.Lifetime is zero
+const DefaultLifetime = 100 * time.Millisecond
+
+// CapabilityReliability means the peer reports the reliability in envelope extensions
+const CapabilityReliability Capability = "reliability"
+
+const (
+	reliabilityKey = "reliability"
+	lifetimeKey    = "lifetime"
+)
+
+var reliabilityNames = map[Reliability]string{
+	ReliabilityUnreliable: "unreliable",
+	ReliabilityPartial:    "partial",
+	ReliabilityReliable:   "reliable",
+}
+
+func (r Reliability) String() string {
+	if s, ok := reliabilityNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Reliability(%d)", int(r))
+}
+
+func ParseReliability(s string) (Reliability, error) {
+	for r, name := range reliabilityNames {
+		if name == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reliability %q", s)
+}
+
+// dataChannelInit returns the init of data DataChannels, the control DataChannel is always reliable
+func (opts Options) dataChannelInit() *webrtc.DataChannelInit {
+	switch opts.Reliability {
+	case ReliabilityReliable:
+		return &webrtc.DataChannelInit{Ordered: refVal(true)}
+	case ReliabilityPartial:
+		return &webrtc.DataChannelInit{
+			Ordered:           refVal(opts.Ordered),
+			MaxPacketLifeTime: refVal(uint16(opts.lifetime().Milliseconds())),
+		}
+	default:
+		return &webrtc.DataChannelInit{
+			Ordered:        refVal(opts.Ordered),
+			MaxRetransmits: refVal(uint16(0)),
+		}
+	}
+}
+
+func (opts Options) lifetime() time.Duration {
+	if opts.Lifetime == 0 {
+		return DefaultLifetime
+	}
+	return opts.Lifetime
+}
+
+// extensions are put into the envelope of offer and answer
+func (opts Options) extensions() map[string]string {
+	ext := map[string]string{reliabilityKey: opts.Reliability.String()}
+	if opts.Transport != TransportDataChannel {
+		ext[transportKey] = opts.Transport.String()
+	}
+	if opts.Reliability == ReliabilityPartial {
+		ext[lifetimeKey] = strconv.FormatInt(opts.lifetime().Milliseconds(), 10)
+	}
+	return ext
+}
+
+// parseReliability reads the reliability from envelope extensions, peers before it are unreliable
+func parseReliability(ext map[string]string) (r Reliability, lifetime time.Duration, err error) {
+	s, ok := ext[reliabilityKey]
+	if !ok {
+		return
+	}
+	if r, err = ParseReliability(s); err != nil || r != ReliabilityPartial {
+		return
+	}
+	ms, err := strconv.ParseUint(ext[lifetimeKey], 10, 16)
+	if err != nil {
+		return r, 0, fmt.Errorf("lifetime %q: %w", ext[lifetimeKey], err)
+	}
+	return r, time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,41 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+)
+
+func TestReliability(t *testing.T) {
+	opts := Options{Reliability: ReliabilityPartial}
+	init := opts.dataChannelInit()
+	assert.Equal(*init.MaxPacketLifeTime, uint16(DefaultLifetime.Milliseconds()))
+	assert.Nil(init.MaxRetransmits)
+
+	r, lifetime := try.To2(parseReliability(opts.extensions()))
+	assert.Equal(r, ReliabilityPartial)
+	assert.Equal(lifetime, DefaultLifetime)
+
+	opts = Options{Reliability: ReliabilityReliable}
+	init = opts.dataChannelInit()
+	assert.That(*init.Ordered)
+	assert.Nil(init.MaxRetransmits)
+	assert.Nil(init.MaxPacketLifeTime)
+
+	init = Options{}.dataChannelInit()
+	assert.Equal(*init.MaxRetransmits, uint16(0))
+
+	// peers before the reliability capability are unreliable
+	r, _ = try.To2(parseReliability(nil))
+	assert.Equal(r, ReliabilityUnreliable)
+
+	_, _, err := parseReliability(map[string]string{reliabilityKey: "best"})
+	assert.Error(err)
+	_, _, err = parseReliability(map[string]string{reliabilityKey: "partial", lifetimeKey: "70000"})
+	assert.Error(err)
+
+	_, lifetime = try.To2(parseReliability(Options{Reliability: ReliabilityPartial, Lifetime: time.Second}.extensions()))
+	assert.Equal(lifetime, time.Second)
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Transport carries wireguard packets over DataChannels or RTP
+type Transport int
+
+const (
+	TransportDataChannel Transport = iota
+	// TransportRTP puts wireguard packets into RTP packets of a video track,
+	// for networks which allow webrtc media but block sctp
+	TransportRTP
+)
+
+// CapabilityRTP means the peer answers with a video track to carry packets
+const CapabilityRTP Capability = "rtp"
+
+var ErrRTPUnsupported = errors.New("peer doesn't support rtp transport")
+
+const (
+	transportKey = "transport"
+
+	// RTPReceiveMTU fits wireguard packets of tun mtu 1420 with rtp header
+	RTPReceiveMTU = 1600
+	// rtp header and srtp auth tag
+	srtpOverhead = 12 + 10
+	// video clock rate
+	rtpClockRate = 90000
+)
+
+var rtpCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: rtpClockRate}
+
+var transportNames = map[Transport]string{
+	TransportDataChannel: "datachannel",
+	TransportRTP:         "rtp",
+}
+
+func (t Transport) String() string {
+	if s, ok := transportNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Transport(%d)", int(t))
+}
+
+func ParseTransport(s string) (Transport, error) {
+	for t, name := range transportNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transport %q", s)
+}
+
+// RTPPathMTU is like PathMTU, but rtp packets are not limited by sctp
+func RTPPathMTU(linkMTU int, ipv6, relay bool) int {
+	if linkMTU == 0 {
+		linkMTU = DefaultLinkMTU
+	}
+	ip := ipv4Overhead
+	if ipv6 {
+		ip = ipv6Overhead
+	}
+	mtu := linkMTU - ip - udpOverhead - srtpOverhead
+	if relay {
+		mtu -= turnOverhead
+	}
+	if max := RTPReceiveMTU - srtpOverhead; mtu > max {
+		mtu = max
+	}
+	return mtu
+}
+
+// addTrack sends packets over a video track and receives them from the track of peer
+func (t *transport) addTrack(pc *webrtc.PeerConnection) (err error) {
+	track, err := webrtc.NewTrackLocalStaticRTP(rtpCodec, Label, Label)
+	if err != nil {
+		return
+	}
+	if _, err = pc.AddTrack(track); err != nil {
+		return
+	}
+	pc.OnTrack(t.readTrack)
+
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	t.track = track
+	t.dtls = pc.SCTP().Transport()
+	t.started = time.Now()
+	return
+}
+
+func (t *transport) readTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		t.receive(webrtc.DataChannelMessage{Data: pkt.Payload})
+	}
+}
+
+// sendRTP is called with locker held
+func (t *transport) sendRTP(buf []byte) {
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: uint16(t.seq.Add(1)),
+			Timestamp:      uint32(time.Since(t.started).Milliseconds() * rtpClockRate / 1000),
+		},
+		// wireguard reuses buf once Send returns
+		Payload: append([]byte(nil), buf...),
+	}
+	track := t.track
+	go func() {
+		if err := track.WriteRTP(pkt); err != nil && t.onError != nil {
+			t.onError(err)
+		}
+	}()
+}
+
+// wait waits for ice to connect, then the DataChannel dc or the dtls of rtp to open
+func (t *transport) wait(pc *webrtc.PeerConnection, dc *webrtc.DataChannel, timeouts Timeouts) error {
+	if err := WaitICE(pc, timeouts.ICE); err != nil {
+		return asTimeout(PhaseICE, timeouts.ICE, err)
+	}
+	t.locker.RLock()
+	dtls := t.dtls
+	t.locker.RUnlock()
+	if dtls != nil {
+		return asTimeout(PhaseDataChannel, timeouts.DataChannel, WaitDTLS(dtls, timeouts.DataChannel))
+	}
+	return asTimeout(PhaseDataChannel, timeouts.DataChannel, WaitDC(dc, timeouts.DataChannel))
+}
+
+// parseTransport reads the transport from envelope extensions, peers before it use DataChannels
+func parseTransport(ext map[string]string) (Transport, error) {
+	s, ok := ext[transportKey]
+	if !ok {
+		return TransportDataChannel, nil
+	}
+	return ParseTransport(s)
+}
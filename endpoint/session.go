@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/pion/sdp/v3"
+)
+
+// wireguard handshake message types and sizes, see golang.zx2c4.com/wireguard/device
+const (
+	MessageInitiationType  = 1
+	MessageResponseType    = 2
+	MessageCookieReplyType = 3
+
+	MessageInitiationSize = 148
+	MessageResponseSize   = 92
+
+	// MaxMessageSize is the largest message accepted from remote sdp
+	MaxMessageSize = MessageInitiationSize
+)
+
+var (
+	ErrMessageTooLarge = errors.New("handshake message in sdp is too large")
+	ErrInvalidMessage  = errors.New("handshake message in sdp is invalid")
+)
+
+var messageEncoding = base64.StdEncoding.Strict()
+
+// SetMessage puts the wireguard handshake message into sdp
+func SetMessage(sd *sdp.SessionDescription, msg []byte) {
+	SetEnvelope(sd, Envelope{Message: msg})
+}
+
+// Message extracts the wireguard handshake message from sdp, nil means there is no message
+func Message(sd *sdp.SessionDescription) (msg []byte, err error) {
+	env, ok, err := GetEnvelope(sd)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return env.Message, nil
+}
+
+func decodeMessage(s string) (msg []byte, err error) {
+	if len(s) > messageEncoding.EncodedLen(MaxMessageSize) {
+		return nil, ErrMessageTooLarge
+	}
+	if msg, err = messageEncoding.DecodeString(s); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	// encoded length is rounded up to 4 chars
+	if len(msg) > MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return msg, nil
+}
+
+// Initiator extracts the handshake initiation from offer, nil means there is no message
+func Initiator(sd *sdp.SessionDescription) (msg []byte, err error) {
+	return typedMessage(sd, MessageInitiationType, MessageInitiationSize)
+}
+
+// Responder extracts the handshake response from answer, nil means there is no message
+func Responder(sd *sdp.SessionDescription) (msg []byte, err error) {
+	return typedMessage(sd, MessageResponseType, MessageResponseSize)
+}
+
+func typedMessage(sd *sdp.SessionDescription, t byte, size int) (msg []byte, err error) {
+	if msg, err = Message(sd); msg == nil || err != nil {
+		return
+	}
+	if len(msg) != size {
+		return nil, fmt.Errorf("%w: %d bytes, expect %d", ErrInvalidMessage, len(msg), size)
+	}
+	// message type is a little endian uint32
+	if msg[0] != t || msg[1] != 0 || msg[2] != 0 || msg[3] != 0 {
+		return nil, fmt.Errorf("%w: type %x, expect %d", ErrInvalidMessage, msg[:4], t)
+	}
+	return msg, nil
+}
@@ -0,0 +1,125 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/sdp/v3"
+)
+
+func newMessage(t byte, size int) []byte {
+	msg := make([]byte, size)
+	msg[0] = t
+	for i := 4; i < size; i++ {
+		msg[i] = byte(i)
+	}
+	return msg
+}
+
+func sessionSDP(info string) string {
+	return "v=0\r\n" +
+		"o=- 4215775240449105457 2 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"i=" + info + "\r\n" +
+		"t=0 0\r\n" +
+		"a=group:BUNDLE 0\r\n" +
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		"a=sctp-port:5000\r\n"
+}
+
+func TestMessage(t *testing.T) {
+	initiation := newMessage(MessageInitiationType, MessageInitiationSize)
+	response := newMessage(MessageResponseType, MessageResponseSize)
+
+	sd := &sdp.SessionDescription{}
+	assert.SLen(try.To1(Initiator(sd)), 0)
+
+	SetMessage(sd, initiation)
+	assert.DeepEqual(try.To1(Initiator(sd)), initiation)
+	_, err := Responder(sd)
+	assert.Error(err)
+
+	SetMessage(sd, response)
+	assert.DeepEqual(try.To1(Responder(sd)), response)
+	_, err = Initiator(sd)
+	assert.Error(err)
+
+	for _, info := range []string{
+		"not base64",
+		base64.RawStdEncoding.EncodeToString(initiation),
+		base64.StdEncoding.EncodeToString(append(initiation, 0)),
+		base64.StdEncoding.EncodeToString(initiation)[:8] + "\n" + base64.StdEncoding.EncodeToString(initiation)[8:],
+	} {
+		info := sdp.Information(info)
+		sd.SessionInformation = &info
+		_, err := Initiator(sd)
+		assert.Error(err)
+	}
+}
+
+func FuzzMessage(f *testing.F) {
+	f.Add(sessionSDP(base64.StdEncoding.EncodeToString(newMessage(MessageInitiationType, MessageInitiationSize))))
+	f.Add(sessionSDP(base64.StdEncoding.EncodeToString(newMessage(MessageResponseType, MessageResponseSize))))
+	f.Add(sessionSDP("AQAAAA=="))
+	f.Add(sessionSDP("-"))
+	f.Add(sessionSDP("-") + "a=wgortc:1 AQAAAA== caps=a,b x=1\r\n")
+	f.Fuzz(func(t *testing.T, s string) {
+		sd := &sdp.SessionDescription{}
+		if err := sd.Unmarshal([]byte(s)); err != nil {
+			return
+		}
+		msg, err := Message(sd)
+		if err != nil {
+			return
+		}
+		if len(msg) > MaxMessageSize {
+			t.Fatalf("message is %d bytes", len(msg))
+		}
+		// only a well formed handshake message is handed to wireguard
+		if msg, err := Initiator(sd); err == nil && msg != nil {
+			if len(msg) != MessageInitiationSize || msg[0] != MessageInitiationType {
+				t.Fatalf("invalid initiation %x", msg)
+			}
+		}
+		if msg, err := Responder(sd); err == nil && msg != nil {
+			if len(msg) != MessageResponseSize || msg[0] != MessageResponseType {
+				t.Fatalf("invalid response %x", msg)
+			}
+		}
+	})
+}
+
+func FuzzSetMessage(f *testing.F) {
+	f.Add(newMessage(MessageInitiationType, MessageInitiationSize))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		sd := &sdp.SessionDescription{}
+		if err := sd.Unmarshal([]byte(sessionSDP("-"))); err != nil {
+			t.Fatal(err)
+		}
+		SetMessage(sd, msg)
+		b, err := sd.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd2 := &sdp.SessionDescription{}
+		if err := sd2.Unmarshal(b); err != nil {
+			t.Fatal(err)
+		}
+		msg2, err := Message(sd2)
+		if len(msg) > MaxMessageSize {
+			if err == nil {
+				t.Fatalf("%d bytes message is accepted", len(msg))
+			}
+			return
+		}
+		if err != nil || !bytes.Equal(msg, msg2) {
+			t.Fatalf("message %x is decoded as %x, %v", msg, msg2, err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/signaler"
+)
+
+// Phase is a step of the handshake, or PhaseSend of the connected transport
+type Phase string
+
+const (
+	PhaseSetup       Phase = "setup"
+	PhaseGather      Phase = "gather"
+	PhaseSignaling   Phase = "signaling"
+	PhaseVerify      Phase = "verify"
+	PhaseICE         Phase = "ice"
+	PhaseDataChannel Phase = "datachannel"
+	PhaseAnswer      Phase = "answer"
+	PhaseSend        Phase = "send"
+)
+
+// Timeouts of the handshake phases, zero fields mean DefaultTimeouts
+type Timeouts struct {
+	// Gather is how long the outbound waits for ice candidates gathering
+	Gather time.Duration
+	// Signaling is how long the outbound waits for the answer of signaler
+	Signaling time.Duration
+	// ICE is how long both sides wait for ice to connect after signaling,
+	// then the outbound falls back to relay or fails
+	ICE time.Duration
+	// DataChannel is how long both sides wait for the transport to open after ice connected
+	DataChannel time.Duration
+	// Answer is how long the inbound waits to be answered by wireguard and connected,
+	// unanswered ones are rejected with ErrAnswerTimeout, such as duplicated or replayed sessions
+	Answer time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Gather:      10 * time.Second,
+	Signaling:   10 * time.Second,
+	ICE:         5 * time.Second,
+	DataChannel: 5 * time.Second,
+	Answer:      10 * time.Second,
+}
+
+// WithDefaults fills zero fields with DefaultTimeouts
+func (t Timeouts) WithDefaults() Timeouts {
+	if t.Gather == 0 {
+		t.Gather = DefaultTimeouts.Gather
+	}
+	if t.Signaling == 0 {
+		t.Signaling = DefaultTimeouts.Signaling
+	}
+	if t.ICE == 0 {
+		t.ICE = DefaultTimeouts.ICE
+	}
+	if t.DataChannel == 0 {
+		t.DataChannel = DefaultTimeouts.DataChannel
+	}
+	if t.Answer == 0 {
+		t.Answer = DefaultTimeouts.Answer
+	}
+	return t
+}
+
+func (t Timeouts) Validate() error {
+	// in handshake order, so the first negative one is reported
+	for _, p := range []struct {
+		phase Phase
+		d     time.Duration
+	}{
+		{PhaseGather, t.Gather},
+		{PhaseSignaling, t.Signaling},
+		{PhaseICE, t.ICE},
+		{PhaseDataChannel, t.DataChannel},
+		{PhaseAnswer, t.Answer},
+	} {
+		if p.d < 0 {
+			return fmt.Errorf("negative %s timeout %s", p.phase, p.d)
+		}
+	}
+	return nil
+}
+
+// TimeoutError is returned when a handshake phase doesn't finish in time,
+// match the phase by errors.Is(err, ErrICETimeout) or get the duration by errors.As
+type TimeoutError struct {
+	Phase Phase
+	After time.Duration
+}
+
+var (
+	ErrGatherTimeout      = &TimeoutError{Phase: PhaseGather}
+	ErrSignalingTimeout   = &TimeoutError{Phase: PhaseSignaling}
+	ErrICETimeout         = &TimeoutError{Phase: PhaseICE}
+	ErrDataChannelTimeout = &TimeoutError{Phase: PhaseDataChannel}
+	ErrAnswerTimeout      = &TimeoutError{Phase: PhaseAnswer}
+)
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout after %s", e.Phase, e.After)
+}
+
+// Timeout marks it as net.Error timeout
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary marks it as retryable, the peer may answer in time next handshake
+func (e *TimeoutError) Temporary() bool { return true }
+
+// Is matches TimeoutError of the same phase and context.DeadlineExceeded
+func (e *TimeoutError) Is(target error) bool {
+	if t, ok := target.(*TimeoutError); ok {
+		return t.Phase == e.Phase
+	}
+	return target == context.DeadlineExceeded
+}
+
+// asTimeout converts the deadline of phase to TimeoutError
+func asTimeout(phase Phase, after time.Duration, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Phase: phase, After: after}
+	}
+	return err
+}
+
+// await waits for ch at most timeout
+func await[T any](phase Phase, timeout time.Duration, ch <-chan T) (v T, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case v = <-ch:
+		return v, nil
+	case <-timer.C:
+		return v, &TimeoutError{Phase: phase, After: timeout}
+	}
+}
+
+// handshake waits for the answer of sig at most timeout, the signaler keeps running in background then
+func handshake(sig signaler.Channel, id string, offer webrtc.SessionDescription, timeout time.Duration) (*webrtc.SessionDescription, error) {
+	type result struct {
+		answer *webrtc.SessionDescription
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		answer, err := sig.Handshake(id, offer)
+		ch <- result{answer, err}
+	}()
+	r, err := await(PhaseSignaling, timeout, ch)
+	if err != nil {
+		return nil, err
+	}
+	return r.answer, r.err
+}
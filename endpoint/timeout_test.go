@@ -0,0 +1,38 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+)
+
+func TestTimeoutError(t *testing.T) {
+	timeouts := Timeouts{ICE: time.Second}.WithDefaults()
+	assert.Equal(timeouts.ICE, time.Second)
+	assert.Equal(timeouts.Gather, DefaultTimeouts.Gather)
+	assert.Error(Timeouts{Signaling: -1}.Validate())
+	for i := 0; i < 10; i++ {
+		err := Timeouts{Gather: -1, Answer: -1}.Validate()
+		assert.Equal(err.Error(), "negative gather timeout -1ns")
+	}
+
+	err := asTimeout(PhaseICE, time.Second, context.DeadlineExceeded)
+	assert.That(errors.Is(err, ErrICETimeout))
+	assert.That(!errors.Is(err, ErrDataChannelTimeout))
+	assert.That(errors.Is(err, context.DeadlineExceeded))
+	var te *TimeoutError
+	assert.That(errors.As(err, &te))
+	assert.Equal(te.After, time.Second)
+	assert.Equal(err.Error(), "ice timeout after 1s")
+	assert.Equal(asTimeout(PhaseICE, time.Second, ErrICEClosed), ErrICEClosed)
+
+	ch := make(chan int, 1)
+	_, err = await(PhaseGather, 10*time.Millisecond, ch)
+	assert.That(errors.Is(err, ErrGatherTimeout))
+	ch <- 1
+	assert.Equal(try.To1(await(PhaseGather, 10*time.Millisecond, ch)), 1)
+}
@@ -0,0 +1,283 @@
+package endpoint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Label is the DataChannel label of the first channel, the extra ones are `wgortc-1`, `wgortc-2`...
+const Label = "wgortc"
+
+// ControlLabel is the DataChannel label of the reliable ordered channel for handshake and keepalive messages
+const ControlLabel = Label + "-control"
+
+// MaxChannels limits DataChannels per PeerConnection
+const MaxChannels = 16
+
+// CapabilityChannels means the peer merges packets from extra DataChannels
+const CapabilityChannels Capability = "channels"
+
+// CapabilityControl means the peer accepts the control DataChannel
+const CapabilityControl Capability = "control"
+
+// transport stripes packets over the DataChannels of a PeerConnection and merges the received ones.
+//
+// packets are striped round robin, wireguard packets are encrypted so there is no inner flow to hash,
+// the receiver index is the same for all packets of a peer
+type transport struct {
+	ch chan []byte
+
+	dcs []*webrtc.DataChannel
+	// control carries handshake, cookie and keepalive messages, so they are not lost with data packets
+	control *webrtc.DataChannel
+	next    atomic.Uint32
+	locker  *sync.RWMutex
+
+	reliability atomic.Int32
+
+	// fragmentSize splits larger packets, zero disables fragmentation
+	fragmentSize atomic.Int32
+	fragmentID   atomic.Uint32
+	reassembler  *reassembler
+	// probedMTU is the largest probe acked by the peer, zero before the first ack
+	probedMTU atomic.Int32
+
+	padding atomic.Int32
+	// gen is increased when the DataChannels are replaced
+	gen atomic.Uint32
+
+	// track replaces DataChannels for TransportRTP
+	track   *webrtc.TrackLocalStaticRTP
+	dtls    *webrtc.DTLSTransport
+	seq     atomic.Uint32
+	started time.Time
+
+	// onError receives the failures of asynchronous sends, it is set by the endpoint
+	onError func(err error)
+}
+
+// Reliability of data DataChannels
+func (t *transport) Reliability() Reliability {
+	return Reliability(t.reliability.Load())
+}
+
+func (t *transport) setReliability(r Reliability) {
+	t.reliability.Store(int32(r))
+}
+
+func newTransport() transport {
+	return transport{
+		ch:     make(chan []byte),
+		locker: &sync.RWMutex{},
+
+		reassembler: &reassembler{},
+	}
+}
+
+func channelLabel(i int) string {
+	if i == 0 {
+		return Label
+	}
+	return fmt.Sprintf("%s-%d", Label, i)
+}
+
+// channelIndex returns -1 if the label isn't a wgortc channel
+func channelIndex(label string) int {
+	if label == Label {
+		return 0
+	}
+	s, ok := strings.CutPrefix(label, Label+"-")
+	if !ok {
+		return -1
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 || i >= MaxChannels {
+		return -1
+	}
+	return i
+}
+
+// reset drops the channels of the previous PeerConnection
+func (t *transport) reset() {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	t.dcs = nil
+	t.control = nil
+	t.track = nil
+	t.dtls = nil
+	t.padding.Store(int32(PaddingNone))
+	t.fragmentSize.Store(0)
+	t.probedMTU.Store(0)
+	t.gen.Add(1)
+}
+
+// enable turns on the features agreed with the peer once the first DataChannel is open
+func (t *transport) enable(opts Options, caps []Capability, mtu int) {
+	padding := HasCapability(caps, CapabilityPadding) && (opts.Padding != PaddingNone || opts.Cover > 0)
+	if padding {
+		t.setPadding(opts.Padding)
+		mtu -= paddedHeaderSize
+	}
+	if opts.Fragment && HasCapability(caps, CapabilityFragment) {
+		t.setFragmentSize(mtu)
+	}
+	if padding && opts.Cover > 0 {
+		go t.cover(opts.Cover, opts.Padding)
+	}
+}
+
+// setPadding pads the sent packets, the peer must have CapabilityPadding
+func (t *transport) setPadding(p Padding) {
+	t.padding.Store(int32(p))
+}
+
+func (t *transport) setControl(dc *webrtc.DataChannel) {
+	dc.OnMessage(t.receive)
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	t.control = dc
+}
+
+// Control reports whether the control DataChannel is open
+func (t *transport) Control() bool {
+	t.locker.RLock()
+	defer t.locker.RUnlock()
+	return isOpen(t.control)
+}
+
+const (
+	messageTransportType = 4
+	// keepalive is a transport message with empty payload: 16 bytes header and 16 bytes tag
+	messageKeepaliveSize = 32
+)
+
+// isControl reports whether the wireguard message is handshake, cookie reply or keepalive
+func isControl(buf []byte) bool {
+	switch buf[0] {
+	case MessageInitiationType, MessageResponseType, MessageCookieReplyType:
+		return true
+	case messageTransportType:
+		return len(buf) == messageKeepaliveSize
+	}
+	return false
+}
+
+func (t *transport) receive(msg webrtc.DataChannelMessage) {
+	data := msg.Data
+	if isPadded(data) {
+		if data = unpad(data); data == nil {
+			return
+		}
+	}
+	if isFragment(data) {
+		if data = t.reassembler.add(data); data == nil {
+			return
+		}
+	}
+	t.ch <- data
+}
+
+// setFragmentSize enables fragmentation of packets larger than size
+func (t *transport) setFragmentSize(size int) {
+	t.fragmentSize.Store(int32(size))
+}
+
+func (t *transport) setChannel(i int, dc *webrtc.DataChannel) {
+	dc.OnMessage(t.receive)
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	for len(t.dcs) <= i {
+		t.dcs = append(t.dcs, nil)
+	}
+	t.dcs[i] = dc
+}
+
+func isOpen(dc *webrtc.DataChannel) bool {
+	return dc != nil && dc.ReadyState() == webrtc.DataChannelStateOpen
+}
+
+// dcIsClosed reports whether the first channel or the dtls of track is not open
+func (t *transport) dcIsClosed() bool {
+	t.locker.RLock()
+	defer t.locker.RUnlock()
+	if t.track != nil {
+		return t.dtls.State() != webrtc.DTLSTransportStateConnected
+	}
+	return len(t.dcs) == 0 || !isOpen(t.dcs[0])
+}
+
+// Channels returns the count of open DataChannels
+func (t *transport) Channels() (n int) {
+	t.locker.RLock()
+	defer t.locker.RUnlock()
+	for _, dc := range t.dcs {
+		if isOpen(dc) {
+			n++
+		}
+	}
+	return
+}
+
+func (t *transport) send(buf []byte) {
+	t.locker.RLock()
+	defer t.locker.RUnlock()
+	p := Padding(t.padding.Load())
+	if dc := t.control; isOpen(dc) && isControl(buf) {
+		if p != PaddingNone {
+			buf = pad(buf, p)
+		}
+		t.sendAsync(dc, buf)
+		return
+	}
+	if size := int(t.fragmentSize.Load()); size > 0 && len(buf) > size {
+		id := uint16(t.fragmentID.Add(1))
+		for _, frag := range fragment(buf, size, id) {
+			t.sendPadded(frag, p)
+		}
+		return
+	}
+	t.sendPadded(buf, p)
+}
+
+func (t *transport) sendPadded(buf []byte, p Padding) {
+	if p != PaddingNone {
+		buf = pad(buf, p)
+	}
+	t.sendData(buf)
+}
+
+// sendData stripes buf over the data DataChannels, locker is held by send
+func (t *transport) sendData(buf []byte) {
+	if t.track != nil {
+		t.sendRTP(buf)
+		return
+	}
+	n := uint32(len(t.dcs))
+	next := t.next.Add(1)
+	for i := uint32(0); i < n; i++ {
+		if dc := t.dcs[(next+i)%n]; isOpen(dc) {
+			t.sendAsync(dc, buf)
+			return
+		}
+	}
+}
+
+// sendAsync sends a copy of buf, wireguard reuses buf once Send returns
+func (t *transport) sendAsync(dc *webrtc.DataChannel, buf []byte) {
+	buf = append([]byte(nil), buf...)
+	go func() {
+		if err := dc.Send(buf); err != nil && t.onError != nil {
+			t.onError(err)
+		}
+	}()
+}
+
+func (t *transport) Message() (ch <-chan []byte) {
+	return t.ch
+}
@@ -0,0 +1,24 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+)
+
+func TestChannelLabel(t *testing.T) {
+	for i := 0; i < MaxChannels; i++ {
+		assert.Equal(channelIndex(channelLabel(i)), i)
+	}
+	for _, l := range []string{"", "wgortc-", "wgortc-0", "wgortc-16", "wgortc-x", ControlLabel, "other"} {
+		assert.Equal(channelIndex(l), -1, l)
+	}
+}
+
+func TestIsControl(t *testing.T) {
+	assert.That(isControl(newMessage(MessageInitiationType, MessageInitiationSize)))
+	assert.That(isControl(newMessage(MessageResponseType, MessageResponseSize)))
+	assert.That(isControl(newMessage(MessageCookieReplyType, 64)))
+	assert.That(isControl(newMessage(messageTransportType, messageKeepaliveSize)))
+	assert.That(!isControl(newMessage(messageTransportType, messageKeepaliveSize+16)))
+}
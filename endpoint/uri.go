@@ -0,0 +1,216 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const Scheme = "webrtc"
+
+// Options is the per endpoint options, zero value means follow the Bind settings
+type Options struct {
+	// Signaler is the name of signaler used to handshake, empty is the default signaler
+	Signaler string
+
+	ICEServers         []webrtc.ICEServer
+	ICETransportPolicy webrtc.ICETransportPolicy
+	// CandidateTypes limits the local candidates, empty means all
+	CandidateTypes []webrtc.ICECandidateType
+	// NetworkTypes limits the local candidates network, empty means follow the Bind
+	NetworkTypes []webrtc.NetworkType
+
+	Ordered bool
+	// Reliability of data DataChannels, the outbound side chooses it
+	Reliability Reliability
+	// Lifetime is the retransmit window of ReliabilityPartial, zero means DefaultLifetime
+	Lifetime time.Duration
+	// Channels is the count of DataChannels packets are striped over, 0 means follow the Bind
+	Channels int
+
+	// LinkMTU is the mtu of the network path, zero means DefaultLinkMTU
+	LinkMTU int
+	// Fragment splits packets larger than the path mtu if the peer could reassemble them
+	Fragment bool
+
+	// Transport carries packets over DataChannels or RTP, both peers need CapabilityRTP for TransportRTP
+	Transport Transport
+
+	// Padding hides packet sizes if the peer could strip it
+	Padding Padding
+	// Cover sends padded frames without payload at this interval, zero disables cover traffic
+	Cover time.Duration
+
+	// Fingerprints pin the dtls certificate of peer, answers with other fingerprints are rejected
+	Fingerprints []webrtc.DTLSFingerprint
+
+	// PeerKey is the wireguard public key of peer, which signs its dtls identity when PrivateKey is set
+	PeerKey Key
+	// PrivateKey is the wireguard private key of this device, it binds the dtls identity to the wireguard key.
+	// it is filled by the Bind as well as TrustedKeys, which are the keys of peers allowed to connect in
+	PrivateKey  Key
+	TrustedKeys []Key
+
+	// Timeouts of the handshake, they are filled by the Bind
+	Timeouts Timeouts
+	// OnError receives the asynchronous failures of the endpoint as *Error, it is filled by the Bind
+	OnError func(err error)
+
+	// Direct is the udp address of peer, hybrid bind races it against webrtc
+	Direct netip.AddrPort
+
+	// Capabilities are advertised to the peer, they are filled by the Bind
+	Capabilities []Capability
+
+	// set is the keys of uri query, so zero values set by uri don't follow the Bind
+	set map[string]bool
+}
+
+// IsSet reports whether the uri sets the option key, such as `reliability`
+func (o Options) IsSet(key string) bool {
+	return o.set[key]
+}
+
+var ErrInvalidURI = errors.New("invalid endpoint uri")
+
+// ParseURI parses endpoint like
+//
+//	webrtc://name?signaler=ws&ice=stun:stun.l.google.com:19302&relay=force&ordered=false
+//	webrtc://name?candidates=host&network=udp4
+//	webrtc://name?channels=4&reliability=partial&lifetime=200ms
+//	webrtc://name?mtu=1280&fragment=true
+//	webrtc://name?padding=bucket&cover=50ms
+//	webrtc://name?transport=rtp
+//	webrtc://name?fingerprint=sha-256:AB:CD:...
+//	webrtc://name?pubkey=<hex or url escaped base64 wireguard public key>
+//
+// bare name without scheme is returned as is with zero Options
+func ParseURI(s string) (id string, opts Options, err error) {
+	if !strings.HasPrefix(s, Scheme+"://") {
+		return s, opts, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", opts, fmt.Errorf("%w: %w", ErrInvalidURI, err)
+	}
+	if id = u.Host + u.Path; id == "" {
+		return "", opts, fmt.Errorf("%w: name is required", ErrInvalidURI)
+	}
+
+	var username, credential string
+	opts.set = map[string]bool{}
+	for k, vv := range u.Query() {
+		v := vv[len(vv)-1]
+		opts.set[k] = true
+		switch k {
+		case "signaler":
+			opts.Signaler = v
+		case "ice":
+			for _, v := range vv {
+				if _, err = ice.ParseURL(v); err != nil {
+					return "", opts, fmt.Errorf("%w: ice %s: %w", ErrInvalidURI, v, err)
+				}
+				opts.ICEServers = append(opts.ICEServers, webrtc.ICEServer{URLs: []string{v}})
+			}
+		case "username":
+			username = v
+		case "credential":
+			credential = v
+		case "relay":
+			switch v {
+			case "force":
+				opts.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+			case "", "allow":
+				opts.ICETransportPolicy = webrtc.ICETransportPolicyAll
+			default:
+				return "", opts, fmt.Errorf("%w: relay %s", ErrInvalidURI, v)
+			}
+		case "candidates":
+			for _, v := range strings.Split(v, ",") {
+				t, err := webrtc.NewICECandidateType(v)
+				if err != nil {
+					return "", opts, fmt.Errorf("%w: candidates %s", ErrInvalidURI, v)
+				}
+				opts.CandidateTypes = append(opts.CandidateTypes, t)
+			}
+		case "network":
+			for _, v := range strings.Split(v, ",") {
+				t, err := webrtc.NewNetworkType(v)
+				if err != nil {
+					return "", opts, fmt.Errorf("%w: network %s", ErrInvalidURI, v)
+				}
+				opts.NetworkTypes = append(opts.NetworkTypes, t)
+			}
+		case "ordered":
+			if opts.Ordered, err = strconv.ParseBool(v); err != nil {
+				return "", opts, fmt.Errorf("%w: ordered %s", ErrInvalidURI, v)
+			}
+		case "reliability":
+			if opts.Reliability, err = ParseReliability(v); err != nil {
+				return "", opts, fmt.Errorf("%w: %w", ErrInvalidURI, err)
+			}
+		case "lifetime":
+			if opts.Lifetime, err = time.ParseDuration(v); err != nil || opts.Lifetime < time.Millisecond || opts.Lifetime > math.MaxUint16*time.Millisecond {
+				return "", opts, fmt.Errorf("%w: lifetime %s", ErrInvalidURI, v)
+			}
+		case "channels":
+			if opts.Channels, err = strconv.Atoi(v); err != nil || opts.Channels < 1 || opts.Channels > MaxChannels {
+				return "", opts, fmt.Errorf("%w: channels %s", ErrInvalidURI, v)
+			}
+		case "mtu":
+			if opts.LinkMTU, err = strconv.Atoi(v); err != nil || opts.LinkMTU < MinLinkMTU || opts.LinkMTU > MaxLinkMTU {
+				return "", opts, fmt.Errorf("%w: mtu %s", ErrInvalidURI, v)
+			}
+		case "fragment":
+			if opts.Fragment, err = strconv.ParseBool(v); err != nil {
+				return "", opts, fmt.Errorf("%w: fragment %s", ErrInvalidURI, v)
+			}
+		case "transport":
+			if opts.Transport, err = ParseTransport(v); err != nil {
+				return "", opts, fmt.Errorf("%w: %w", ErrInvalidURI, err)
+			}
+		case "padding":
+			if opts.Padding, err = ParsePadding(v); err != nil {
+				return "", opts, fmt.Errorf("%w: %w", ErrInvalidURI, err)
+			}
+		case "cover":
+			if opts.Cover, err = time.ParseDuration(v); err != nil || opts.Cover < time.Millisecond {
+				return "", opts, fmt.Errorf("%w: cover %s", ErrInvalidURI, v)
+			}
+		case "fingerprint":
+			for _, v := range vv {
+				fp, err := ParseFingerprint(v)
+				if err != nil {
+					return "", opts, fmt.Errorf("%w: %w", ErrInvalidURI, err)
+				}
+				opts.Fingerprints = append(opts.Fingerprints, fp)
+			}
+		case "pubkey":
+			if opts.PeerKey, err = ParseKey(v); err != nil {
+				return "", opts, fmt.Errorf("%w: pubkey %w", ErrInvalidURI, err)
+			}
+		case "direct":
+			if opts.Direct, err = netip.ParseAddrPort(v); err != nil {
+				return "", opts, fmt.Errorf("%w: direct %s", ErrInvalidURI, v)
+			}
+		default:
+			return "", opts, fmt.Errorf("%w: unknown option %s", ErrInvalidURI, k)
+		}
+	}
+	for i, s := range opts.ICEServers {
+		if strings.HasPrefix(s.URLs[0], "turn") {
+			opts.ICEServers[i].Username = username
+			opts.ICEServers[i].Credential = credential
+		}
+	}
+
+	return id, opts, nil
+}
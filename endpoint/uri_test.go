@@ -0,0 +1,80 @@
+package endpoint_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/endpoint"
+)
+
+func TestParseURI(t *testing.T) {
+	id, opts := try.To2(endpoint.ParseURI("server"))
+	assert.Equal(id, "server")
+	assert.DeepEqual(opts, endpoint.Options{})
+
+	id, opts = try.To2(endpoint.ParseURI("webrtc://server?signaler=ws&ice=stun:127.0.0.1:3478&ice=turn:127.0.0.1:3478&username=u&credential=p&relay=force&ordered=true&direct=127.0.0.1:51820"))
+	assert.Equal(id, "server")
+	assert.Equal(opts.Signaler, "ws")
+	assert.Equal(opts.ICETransportPolicy, webrtc.ICETransportPolicyRelay)
+	assert.Equal(opts.Ordered, true)
+	assert.Equal(opts.Direct, netip.MustParseAddrPort("127.0.0.1:51820"))
+	assert.SLen(opts.ICEServers, 2)
+	assert.Equal(opts.ICEServers[0].Username, "")
+	assert.Equal(opts.ICEServers[1].Username, "u")
+	assert.Equal(opts.ICEServers[1].Credential, "p")
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?channels=4&reliability=partial&lifetime=200ms"))
+	assert.Equal(opts.Channels, 4)
+	assert.Equal(opts.Reliability, endpoint.ReliabilityPartial)
+	assert.Equal(opts.Lifetime, 200*time.Millisecond)
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?mtu=1280&fragment=true"))
+	assert.Equal(opts.LinkMTU, 1280)
+	assert.That(opts.Fragment)
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?padding=bucket&cover=50ms"))
+	assert.Equal(opts.Padding, endpoint.PaddingBucket)
+	assert.Equal(opts.Cover, 50*time.Millisecond)
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?transport=rtp"))
+	assert.Equal(opts.Transport, endpoint.TransportRTP)
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?fingerprint=sha-256:AB:CD&fingerprint=sha-256:EF"))
+	assert.DeepEqual(opts.Fingerprints, []webrtc.DTLSFingerprint{{Algorithm: "sha-256", Value: "ab:cd"}, {Algorithm: "sha-256", Value: "ef"}})
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?pubkey=c4c8e984c5322c8184c72265b92b250fdb63688705f504ba003c88f03393cf28"))
+	assert.Equal(opts.PeerKey.String(), "xMjphMUyLIGExyJluSslD9tjaIcF9QS6ADyI8DOTzyg=")
+
+	_, opts = try.To2(endpoint.ParseURI("webrtc://server?candidates=host,srflx&network=udp4"))
+	assert.DeepEqual(opts.CandidateTypes, []webrtc.ICECandidateType{webrtc.ICECandidateTypeHost, webrtc.ICECandidateTypeSrflx})
+	assert.DeepEqual(opts.NetworkTypes, []webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+
+	for _, s := range []string{
+		"webrtc://",
+		"webrtc://server?relay=maybe",
+		"webrtc://server?ice=http://127.0.0.1",
+		"webrtc://server?direct=127.0.0.1",
+		"webrtc://server?candidates=host,local",
+		"webrtc://server?network=udp5",
+		"webrtc://server?channels=0",
+		"webrtc://server?channels=17",
+		"webrtc://server?reliability=best",
+		"webrtc://server?lifetime=100",
+		"webrtc://server?lifetime=2m",
+		"webrtc://server?mtu=1000",
+		"webrtc://server?fragment=maybe",
+		"webrtc://server?padding=zero",
+		"webrtc://server?cover=0",
+		"webrtc://server?transport=sctp",
+		"webrtc://server?fingerprint=AB",
+		"webrtc://server?pubkey=c4c8",
+		"webrtc://server?unknown=1",
+	} {
+		_, _, err := endpoint.ParseURI(s)
+		assert.Error(err, s)
+	}
+}
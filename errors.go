@@ -0,0 +1,18 @@
+package wgortc
+
+// ErrorsBuffer is the capacity of Bind.Errors
+const ErrorsBuffer = 64
+
+// Errors receives the asynchronous failures of endpoints, such as handshakes started by Send
+// and dropped packets of DataChannels, as *endpoint.Error with the phase and the peer.
+// it is never closed, failures are dropped while the buffer is full
+func (b *Bind) Errors() <-chan error {
+	return b.errs
+}
+
+func (b *Bind) report(err error) {
+	select {
+	case b.errs <- err:
+	default:
+	}
+}
@@ -5,8 +5,13 @@ go 1.20
 require (
 	github.com/lainio/err2 v0.9.0
 	github.com/pion/ice/v2 v2.3.2
+	github.com/pion/logging v0.2.2
+	github.com/pion/rtp v1.7.13
 	github.com/pion/sdp/v3 v3.0.6
+	github.com/pion/transport/v2 v2.1.0
+	github.com/pion/turn/v2 v2.1.0
 	github.com/pion/webrtc/v3 v3.1.59
+	golang.org/x/crypto v0.8.0
 	golang.zx2c4.com/wireguard v0.0.0-20230704135630-469159ecf7d1
 )
 
@@ -16,18 +21,13 @@ require (
 	github.com/pion/datachannel v1.5.5 // indirect
 	github.com/pion/dtls/v2 v2.2.6 // indirect
 	github.com/pion/interceptor v0.1.12 // indirect
-	github.com/pion/logging v0.2.2 // indirect
 	github.com/pion/mdns v0.0.7 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
 	github.com/pion/rtcp v1.2.10 // indirect
-	github.com/pion/rtp v1.7.13 // indirect
 	github.com/pion/sctp v1.8.6 // indirect
 	github.com/pion/srtp/v2 v2.0.12 // indirect
 	github.com/pion/stun v0.4.0 // indirect
-	github.com/pion/transport/v2 v2.1.0 // indirect
-	github.com/pion/turn/v2 v2.1.0 // indirect
 	github.com/pion/udp/v2 v2.0.1 // indirect
-	golang.org/x/crypto v0.8.0 // indirect
 	golang.org/x/exp v0.0.0-20230105202349-8879d0199aa3 // indirect
 	golang.org/x/net v0.9.0 // indirect
 	golang.org/x/sys v0.7.0 // indirect
@@ -0,0 +1,333 @@
+package hybrid
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shynome/wgortc/endpoint"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// Endpoint races a direct udp path against webrtc, it is created by endpoint uri `webrtc://name?direct=ip:port`.
+//
+// handshake initiations are sent over both paths, data follows the path of the first handshake response
+// and is committed to it once the peer sends a transport message over it.
+// while webrtc is used, the direct path is probed and upgraded to once the peer answers.
+type Endpoint struct {
+	rtc    *endpoint.Outbound
+	direct conn.Endpoint
+	addr   netip.AddrPort
+
+	useDirect atomic.Bool
+	// confirmed is set once a transport message to index comes, later ones don't change the path
+	confirmed atomic.Bool
+
+	locker sync.Mutex
+	// index is our receiver index of the last handshake, forged messages can't guess it
+	index []byte
+	// pending is the path of the response to our initiation, data follows it until confirmed
+	pending path
+	// initiation is the last received one, its copy over the other path is ignored,
+	// the response goes back over the path it came first
+	initiation   []byte
+	responsePath path
+	// nonce of the last probe, only the ack which echoes it upgrades to the direct path
+	nonce []byte
+}
+
+var _ conn.Endpoint = (*Endpoint)(nil)
+
+func (e *Endpoint) UseDirect() bool { return e.useDirect.Load() }
+
+func (e *Endpoint) active() conn.Endpoint {
+	if e.UseDirect() {
+		return e.direct
+	}
+	return e.rtc
+}
+
+// used for mac2 cookie calculations, keep it stable between paths
+func (e *Endpoint) DstToBytes() []byte  { return e.rtc.DstToBytes() }
+func (e *Endpoint) DstToString() string { return e.active().DstToString() }
+func (e *Endpoint) ClearSrc()           { e.direct.ClearSrc() }
+func (e *Endpoint) SrcToString() string { return e.active().SrcToString() }
+func (e *Endpoint) DstIP() netip.Addr   { return e.active().DstIP() }
+func (e *Endpoint) SrcIP() netip.Addr   { return e.active().SrcIP() }
+
+type path uint8
+
+const (
+	pathNone path = iota
+	pathRTC
+	pathDirect
+)
+
+func pathOf(direct bool) path {
+	if direct {
+		return pathDirect
+	}
+	return pathRTC
+}
+
+const (
+	messageInitiationType = 1
+	messageResponseType   = 2
+	messageTransportType  = 4
+
+	// keepalive is the smallest transport message, header and auth tag
+	messageKeepaliveSize = 32
+
+	probeType    = 0xf0
+	probeAckType = 0xf1
+)
+
+// isMessage checks the type, exact size and zero reserved bytes of handshake messages
+func isMessage(pkt []byte, t byte, size int) bool {
+	return len(pkt) == size && isType(pkt, t)
+}
+
+func isTransport(pkt []byte) bool {
+	return len(pkt) >= messageKeepaliveSize && isType(pkt, messageTransportType)
+}
+
+func isType(pkt []byte, t byte) bool {
+	return pkt[0] == t && pkt[1] == 0 && pkt[2] == 0 && pkt[3] == 0
+}
+
+var probeMagic = []byte("wgortc")
+
+const nonceSize = 16
+
+func newProbe(t byte, nonce []byte) []byte {
+	return append(append([]byte{t}, probeMagic...), nonce...)
+}
+
+func isProbe(pkt []byte, t byte) bool {
+	return len(pkt) == 1+len(probeMagic)+nonceSize && pkt[0] == t && bytes.Equal(pkt[1:1+len(probeMagic)], probeMagic)
+}
+
+func probeNonce(pkt []byte) []byte { return pkt[1+len(probeMagic):] }
+
+// newNonce starts a probe, the nonce of the previous one is dropped
+func (e *Endpoint) newNonce() []byte {
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	e.nonce = nonce
+	return nonce
+}
+
+// acked reports whether the ack echoes the nonce of the last probe, the nonce is used once
+func (e *Endpoint) acked(nonce []byte) bool {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if e.nonce == nil || subtle.ConstantTimeCompare(e.nonce, nonce) != 1 {
+		return false
+	}
+	e.nonce = nil
+	return true
+}
+
+// handshakeStarted remembers our receiver index of a sent initiation or response,
+// the path is confirmed again by the transport messages to it
+func (e *Endpoint) handshakeStarted(msg []byte) {
+	e.index = append(e.index[:0], msg[4:8]...)
+	e.pending = pathNone
+	e.confirmed.Store(false)
+}
+
+// initiate starts a race once an initiation is sent over both paths
+func (e *Endpoint) initiate(msg []byte) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	e.handshakeStarted(msg)
+}
+
+// respond reports whether the response goes back over the direct path of the initiation it answers
+func (e *Endpoint) respond(msg []byte) (direct bool) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	e.handshakeStarted(msg)
+	return e.isDirect(e.responsePath)
+}
+
+// sendDirect reports whether data goes over the direct path,
+// it is the pending path of our handshake until the peer confirms one
+func (e *Endpoint) sendDirect() bool {
+	if e.confirmed.Load() {
+		return e.UseDirect()
+	}
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	return e.isDirect(e.pending)
+}
+
+func (e *Endpoint) isDirect(p path) bool {
+	if p == pathNone {
+		return e.UseDirect()
+	}
+	return p == pathDirect
+}
+
+// initiated picks the path of the response, a new initiation of the peer counts but not its copy over the other path
+func (e *Endpoint) initiated(msg []byte, direct bool) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if bytes.Equal(msg, e.initiation) {
+		return
+	}
+	e.initiation = append(e.initiation[:0], msg...)
+	e.responsePath = pathOf(direct)
+}
+
+// responded picks the first path of the response to our initiation
+func (e *Endpoint) responded(msg []byte, direct bool) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if e.pending != pathNone || e.index == nil || !bytes.Equal(msg[8:12], e.index) {
+		return
+	}
+	e.pending = pathOf(direct)
+}
+
+// transport commits to the path of the first transport message to our receiver index
+func (e *Endpoint) transport(msg []byte, direct bool) {
+	if e.confirmed.Load() {
+		return
+	}
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if e.index == nil || !bytes.Equal(msg[4:8], e.index) {
+		return
+	}
+	e.useDirect.Store(direct)
+	e.pending = pathNone
+	e.confirmed.Store(true)
+}
+
+// received tracks the handshake messages of a path, wireguard drops the forged ones later
+func (e *Endpoint) received(pkt []byte, direct bool) {
+	switch {
+	case isMessage(pkt, messageInitiationType, endpoint.MessageInitiationSize):
+		e.initiated(pkt, direct)
+	case isMessage(pkt, messageResponseType, endpoint.MessageResponseSize):
+		e.responded(pkt, direct)
+	case isTransport(pkt):
+		e.transport(pkt, direct)
+	}
+}
+
+func (b *Bind) sendEyeballs(bufs [][]byte, e *Endpoint) (err error) {
+	for _, buf := range bufs {
+		switch {
+		case isMessage(buf, messageInitiationType, endpoint.MessageInitiationSize):
+			e.initiate(buf)
+			errDirect := b.Direct.Send([][]byte{buf}, e.direct)
+			if err = b.RTC.Send([][]byte{buf}, e.rtc); err != nil && errDirect == nil {
+				err = nil
+			}
+		case isMessage(buf, messageResponseType, endpoint.MessageResponseSize):
+			err = b.sendOver(buf, e, e.respond(buf))
+		default:
+			err = b.sendOver(buf, e, e.sendDirect())
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (b *Bind) sendOver(buf []byte, e *Endpoint, direct bool) error {
+	if direct {
+		return b.Direct.Send([][]byte{buf}, e.direct)
+	}
+	return b.RTC.Send([][]byte{buf}, e.rtc)
+}
+
+func (b *Bind) wrapReceiveFunc(fn conn.ReceiveFunc) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
+		n, err = fn(packets, sizes, eps)
+		for i := 0; i < n; i++ {
+			if sizes[i] == 0 {
+				continue
+			}
+			b.received(packets[i][:sizes[i]], &sizes[i], &eps[i])
+		}
+		return
+	}
+}
+
+func (b *Bind) received(pkt []byte, size *int, ep *conn.Endpoint) {
+	if _, ok := (*ep).(endpoint.Sender); ok {
+		e := b.findEyeballs(*ep)
+		if e == nil {
+			return
+		}
+		e.received(pkt, false)
+		*ep = e
+		return
+	}
+
+	if isProbe(pkt, probeType) {
+		b.Direct.Send([][]byte{newProbe(probeAckType, probeNonce(pkt))}, *ep)
+		*size = 0
+		return
+	}
+	addr, err := netip.ParseAddrPort((*ep).DstToString())
+	if err != nil {
+		return
+	}
+	e := b.findEyeballs(addr)
+	if e == nil {
+		return
+	}
+	switch {
+	case isProbe(pkt, probeAckType):
+		if e.acked(probeNonce(pkt)) {
+			e.useDirect.Store(true)
+		}
+		*size = 0
+		return
+	}
+	e.received(pkt, true)
+	*ep = e
+}
+
+func (b *Bind) findEyeballs(k any) *Endpoint {
+	if addr, ok := k.(netip.AddrPort); ok {
+		k = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+	}
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	return b.eyeballs[k]
+}
+
+func (b *Bind) addEyeballs(e *Endpoint) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	if b.eyeballs == nil {
+		b.eyeballs = make(map[any]*Endpoint)
+	}
+	b.eyeballs[e.addr] = e
+	b.eyeballs[conn.Endpoint(e.rtc)] = e
+}
+
+func (b *Bind) probe() {
+	b.locker.RLock()
+	var probes []*Endpoint
+	for k, e := range b.eyeballs {
+		if _, ok := k.(netip.AddrPort); ok && !e.UseDirect() {
+			probes = append(probes, e)
+		}
+	}
+	b.locker.RUnlock()
+	for _, e := range probes {
+		b.Direct.Send([][]byte{newProbe(probeType, e.newNonce())}, e.direct)
+	}
+}
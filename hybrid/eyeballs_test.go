@@ -0,0 +1,111 @@
+package hybrid
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/shynome/wgortc/endpoint"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+func newEyeballs() (*Bind, *Endpoint) {
+	b := &Bind{Direct: conn.NewStdNetBind()}
+	direct := try.To1(b.Direct.ParseEndpoint("127.0.0.1:51820"))
+	e := &Endpoint{
+		rtc:    endpoint.NewOutbound("server", nil),
+		direct: direct,
+		addr:   direct.(*conn.StdNetEndpoint).AddrPort,
+	}
+	b.addEyeballs(e)
+	return b, e
+}
+
+func TestProbeAck(t *testing.T) {
+	b, e := newEyeballs()
+	receive := func(pkt []byte) {
+		size, ep := len(pkt), e.direct
+		b.received(pkt, &size, &ep)
+		assert.Equal(size, 0)
+	}
+
+	// an ack without the nonce of probe is spoofed
+	receive(newProbe(probeAckType, make([]byte, nonceSize)))
+	assert.That(!e.UseDirect())
+
+	b.probe()
+	nonce := append([]byte(nil), e.nonce...)
+	receive(newProbe(probeAckType, make([]byte, nonceSize)))
+	assert.That(!e.UseDirect())
+	receive(newProbe(probeAckType, nonce))
+	assert.That(e.UseDirect())
+}
+
+func newMessage(t byte, size int, index uint32, at int) []byte {
+	msg := make([]byte, size)
+	msg[0] = t
+	binary.LittleEndian.PutUint32(msg[at:], index)
+	return msg
+}
+
+func TestConfirmedPath(t *testing.T) {
+	b, e := newEyeballs()
+	receive := func(pkt []byte, ep conn.Endpoint) {
+		size := len(pkt)
+		b.received(pkt, &size, &ep)
+	}
+
+	// our initiation, data follows the first response and is committed by the transport of peer
+	e.initiate(newMessage(messageInitiationType, endpoint.MessageInitiationSize, 7, 4))
+	receive(newMessage(messageResponseType, endpoint.MessageResponseSize, 7, 8), e.direct)
+	assert.That(e.sendDirect())
+	assert.That(!e.UseDirect())
+	receive(newMessage(messageResponseType, endpoint.MessageResponseSize, 7, 8), e.rtc)
+	assert.That(e.sendDirect())
+	receive(newMessage(messageTransportType, messageKeepaliveSize, 7, 4), e.direct)
+	assert.That(e.UseDirect())
+	// the late webrtc transport doesn't take over
+	receive(newMessage(messageTransportType, messageKeepaliveSize, 7, 4), e.rtc)
+	assert.That(e.UseDirect())
+
+	// the initiation of peer is answered over the path it came first, its copy is ignored
+	initiation := newMessage(messageInitiationType, endpoint.MessageInitiationSize, 8, 4)
+	receive(initiation, e.rtc)
+	receive(initiation, e.direct)
+	assert.That(!e.respond(newMessage(messageResponseType, endpoint.MessageResponseSize, 9, 4)))
+	assert.That(e.UseDirect())
+	receive(newMessage(messageTransportType, messageKeepaliveSize, 9, 4), e.rtc)
+	assert.That(!e.UseDirect())
+}
+
+func TestSpoofedHandshake(t *testing.T) {
+	b, e := newEyeballs()
+	receive := func(pkt []byte) {
+		size, ep := len(pkt), e.direct
+		b.received(pkt, &size, &ep)
+	}
+
+	e.initiate(newMessage(messageInitiationType, endpoint.MessageInitiationSize, 7, 4))
+	// a forged size, reserved bytes or receiver index
+	receive(newMessage(messageResponseType, endpoint.MessageResponseSize+1, 7, 8))
+	reserved := newMessage(messageResponseType, endpoint.MessageResponseSize, 7, 8)
+	reserved[1] = 1
+	receive(reserved)
+	receive(newMessage(messageResponseType, endpoint.MessageResponseSize, 8, 8))
+	assert.That(!e.sendDirect())
+	receive(newMessage(messageTransportType, messageKeepaliveSize-1, 7, 4))
+	receive(newMessage(messageTransportType, messageKeepaliveSize, 8, 4))
+	assert.That(!e.UseDirect())
+
+	size, ep := messageKeepaliveSize, conn.Endpoint(e.rtc)
+	b.received(newMessage(messageTransportType, messageKeepaliveSize, 7, 4), &size, &ep)
+	assert.That(!e.UseDirect())
+
+	// neither handshake messages nor transports switch a confirmed path
+	receive(newMessage(messageInitiationType, endpoint.MessageInitiationSize, 9, 4))
+	receive(newMessage(messageResponseType, endpoint.MessageResponseSize, 7, 8))
+	receive(newMessage(messageTransportType, messageKeepaliveSize, 7, 4))
+	assert.That(!e.UseDirect())
+	assert.That(!e.sendDirect())
+}
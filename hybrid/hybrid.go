@@ -0,0 +1,128 @@
+package hybrid
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/endpoint"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// Bind talks to `ip:port` endpoints over plain udp and to the others via webrtc
+type Bind struct {
+	Direct conn.Bind
+	RTC    conn.Bind
+
+	// ProbeInterval is how often the direct path of webrtc endpoints with `direct` option is probed
+	ProbeInterval time.Duration
+
+	eyeballs map[any]*Endpoint
+	done     chan struct{}
+	locker   sync.RWMutex
+}
+
+var _ conn.Bind = (*Bind)(nil)
+
+func NewBind(rtc *wgortc.Bind) *Bind {
+	return &Bind{
+		Direct: conn.NewStdNetBind(),
+		RTC:    rtc,
+
+		ProbeInterval: 5 * time.Second,
+	}
+}
+
+// Open opens the direct bind on port, the webrtc bind uses a random port
+func (b *Bind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	fns, actualPort, err = b.Direct.Open(port)
+	if err != nil {
+		return
+	}
+	rfns, _, err := b.RTC.Open(0)
+	if err != nil {
+		b.Direct.Close()
+		return nil, 0, err
+	}
+	fns = append(fns, rfns...)
+	for i, fn := range fns {
+		fns[i] = b.wrapReceiveFunc(fn)
+	}
+
+	b.locker.Lock()
+	b.done = make(chan struct{})
+	b.locker.Unlock()
+	if b.ProbeInterval > 0 {
+		go b.probeLoop(b.done)
+	}
+	return
+}
+
+func (b *Bind) probeLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(b.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			b.probe()
+		}
+	}
+}
+
+func (b *Bind) Close() error {
+	b.locker.Lock()
+	if b.done != nil {
+		close(b.done)
+		b.done = nil
+	}
+	b.locker.Unlock()
+	return errors.Join(b.Direct.Close(), b.RTC.Close())
+}
+
+func (b *Bind) SetMark(mark uint32) error {
+	return b.Direct.SetMark(mark)
+}
+
+func (b *Bind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	if e, ok := ep.(*Endpoint); ok {
+		return b.sendEyeballs(bufs, e)
+	}
+	if _, ok := ep.(endpoint.Sender); ok {
+		return b.RTC.Send(bufs, ep)
+	}
+	return b.Direct.Send(bufs, ep)
+}
+
+func (b *Bind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	if _, err := netip.ParseAddrPort(s); err == nil {
+		return b.Direct.ParseEndpoint(s)
+	}
+	ep, err := b.RTC.ParseEndpoint(s)
+	if err != nil {
+		return nil, err
+	}
+	outbound, ok := ep.(*endpoint.Outbound)
+	if !ok || !outbound.Options.Direct.IsValid() {
+		return ep, nil
+	}
+	addr := outbound.Options.Direct
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+	direct, err := b.Direct.ParseEndpoint(addr.String())
+	if err != nil {
+		return nil, err
+	}
+	e := &Endpoint{rtc: outbound, direct: direct, addr: addr}
+	b.addEyeballs(e)
+	return e, nil
+}
+
+func (b *Bind) BatchSize() int {
+	if n := b.RTC.BatchSize(); n > b.Direct.BatchSize() {
+		return n
+	}
+	return b.Direct.BatchSize()
+}
@@ -0,0 +1,106 @@
+package hybrid_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/hybrid"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+func TestHybrid(t *testing.T) {
+	hub := local.NewHub()
+
+	dev, port := startServer(hub)
+	defer dev.Close()
+
+	s := local.NewServer()
+	hub.Register("client", s)
+	dev1, tnet1 := startClient(wgortc.NewBind(s), testutil.ClientConfig("server"), testutil.ClientIP)
+	defer dev1.Close()
+
+	dev2, tnet2 := startClient(conn.NewStdNetBind(), fmt.Sprintf(`private_key=281f553a881eeaf35846aa79a87f246c6e6a7c07d2b5cd3371c130b02d053d70
+public_key=`+testutil.ServerPub+`
+allowed_ip=0.0.0.0/0
+endpoint=127.0.0.1:%d
+`, port), "192.168.4.27")
+	defer dev2.Close()
+
+	assert.Equal(httpGet(tnet1), testutil.Hello)
+	assert.Equal(httpGet(tnet2), testutil.Hello)
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	hub := local.NewHub()
+
+	dev, port := startServer(hub)
+	defer dev.Close()
+
+	s := local.NewServer()
+	hub.Register("client", s)
+	bind := hybrid.NewBind(wgortc.NewBind(s))
+	bind.ProbeInterval = 100 * time.Millisecond
+	dev1, tnet1 := startClient(bind, testutil.ClientConfig(fmt.Sprintf("webrtc://server?direct=127.0.0.1:%d", port)), testutil.ClientIP)
+	defer dev1.Close()
+
+	assert.Equal(httpGet(tnet1), testutil.Hello)
+
+	direct := fmt.Sprintf("endpoint=127.0.0.1:%d", port)
+	for i := 0; i < 50; i++ {
+		if strings.Contains(try.To1(dev1.IpcGet()), direct) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.That(strings.Contains(try.To1(dev1.IpcGet()), direct))
+	assert.Equal(httpGet(tnet1), testutil.Hello)
+}
+
+func TestHappyEyeballsFallback(t *testing.T) {
+	hub := local.NewHub()
+
+	dev, _ := startServer(hub)
+	defer dev.Close()
+
+	s := local.NewServer()
+	hub.Register("client", s)
+	dev1, tnet1 := startClient(hybrid.NewBind(wgortc.NewBind(s)), testutil.ClientConfig("webrtc://server?direct=127.0.0.1:9"), testutil.ClientIP)
+	defer dev1.Close()
+
+	assert.Equal(httpGet(tnet1), testutil.Hello)
+	assert.That(!strings.Contains(try.To1(dev1.IpcGet()), "endpoint=127.0.0.1:9"))
+}
+
+func startServer(hub *local.Hub) (dev *device.Device, port int) {
+	s := local.NewServer()
+	hub.Register("server", s)
+	// allows the plain udp client of TestHybrid too
+	dev, _ = testutil.StartServer(hybrid.NewBind(wgortc.NewBind(s)), testutil.ServerConfig+`public_key=cac7b4160687167e6f5b88b1963af43c98f0bb910234b374855e9b4615d20613
+allowed_ip=192.168.4.27/32
+`)
+
+	conf := try.To1(dev.IpcGet())
+	for _, line := range strings.Split(conf, "\n") {
+		if v, ok := strings.CutPrefix(line, "listen_port="); ok {
+			fmt.Sscan(v, &port)
+		}
+	}
+	return
+}
+
+func startClient(bind conn.Bind, conf string, ip string) (dev *device.Device, tnet *netstack.Net) {
+	return testutil.StartPeer(bind, "client ", ip, conf)
+}
+
+func httpGet(tnet *netstack.Net) string {
+	return testutil.Get(tnet, "/", 10*time.Second)
+}
@@ -0,0 +1,86 @@
+package wgortc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/turnrest"
+)
+
+// ICEServerProvider provides ICEServers for each connection, such as time-limited TURN credentials.
+// servers are cached by Bind and refreshed before expires, zero expires means never
+type ICEServerProvider interface {
+	ICEServers() (servers []webrtc.ICEServer, expires time.Time, err error)
+}
+
+type iceServerCache struct {
+	servers []webrtc.ICEServer
+	fetched time.Time
+	expires time.Time
+	locker  sync.Mutex
+}
+
+func (c *iceServerCache) get(p ICEServerProvider) (servers []webrtc.ICEServer, err error) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	now := time.Now()
+	if !c.fetched.IsZero() {
+		if c.expires.IsZero() {
+			return c.servers, nil
+		}
+		// refresh when less than 1/10 of lifetime remains
+		if refresh := c.fetched.Add(c.expires.Sub(c.fetched) * 9 / 10); now.Before(refresh) {
+			return c.servers, nil
+		}
+	}
+
+	servers, expires, err := p.ICEServers()
+	if err != nil {
+		return
+	}
+	c.servers, c.fetched, c.expires = servers, now, expires
+	return
+}
+
+func (b *Bind) iceServers() (servers []webrtc.ICEServer, err error) {
+	servers = b.ICEServers
+	if b.ICEServerProvider == nil {
+		return
+	}
+	pservers, err := b.iceCache.get(b.ICEServerProvider)
+	if err != nil {
+		return
+	}
+	servers = append(servers[:len(servers):len(servers)], pservers...)
+	return
+}
+
+// TURNRESTProvider implements the TURN REST API credential scheme with a shared secret
+type TURNRESTProvider struct {
+	URLs   []string
+	Secret string
+	User   string
+	// TTL is how long credentials are valid, default is 24h
+	TTL time.Duration
+}
+
+var _ ICEServerProvider = (*TURNRESTProvider)(nil)
+
+func (p *TURNRESTProvider) ICEServers() (servers []webrtc.ICEServer, expires time.Time, err error) {
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	expires = time.Now().Add(ttl)
+	username, credential := turnrest.Credentials(p.Secret, p.User, ttl)
+	servers = []webrtc.ICEServer{
+		{
+			URLs:       p.URLs,
+			Username:   username,
+			Credential: credential,
+		},
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package wgortc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/webrtc/v3"
+)
+
+type countProvider struct {
+	ttl   time.Duration
+	count int
+}
+
+func (p *countProvider) ICEServers() (servers []webrtc.ICEServer, expires time.Time, err error) {
+	p.count++
+	servers = []webrtc.ICEServer{{URLs: []string{"turn:127.0.0.1:3478"}}}
+	return servers, time.Now().Add(p.ttl), nil
+}
+
+func TestICEServerProvider(t *testing.T) {
+	p := &countProvider{ttl: 100 * time.Millisecond}
+	b := NewBind(nil)
+	b.ICEServers = []webrtc.ICEServer{{URLs: []string{"stun:127.0.0.1:3478"}}}
+	b.ICEServerProvider = p
+
+	servers := try.To1(b.iceServers())
+	assert.SLen(servers, 2)
+	assert.SLen(b.ICEServers, 1)
+	try.To1(b.iceServers())
+	assert.Equal(p.count, 1)
+
+	time.Sleep(95 * time.Millisecond) // refresh before expires
+	try.To1(b.iceServers())
+	assert.Equal(p.count, 2)
+}
+
+func TestTURNRESTProvider(t *testing.T) {
+	p := &TURNRESTProvider{URLs: []string{"turn:127.0.0.1:3478"}, Secret: "wgortc", User: "client", TTL: time.Hour}
+	servers, expires := try.To2(p.ICEServers())
+	assert.SLen(servers, 1)
+	assert.That(time.Until(expires) > 59*time.Minute)
+	assert.That(strings.HasSuffix(servers[0].Username, ":client"))
+	assert.NotEmpty(servers[0].Credential.(string))
+}
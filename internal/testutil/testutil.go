@@ -0,0 +1,118 @@
+// Package testutil is the wireguard fixture shared by the tests,
+// a server and a client peer which talk http over netstack
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/lainio/err2/try"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// keys and addresses of the server and client peers
+const (
+	ServerKey = "003ed5d73b55806c30de3f8a7bdab38af13539220533055e635690b8b87ad641"
+	ServerPub = "c4c8e984c5322c8184c72265b92b250fdb63688705f504ba003c88f03393cf28"
+	ClientKey = "087ec6e14bbed210e7215cdc73468dfa23f080a1bfb8665b2fd809bd99d28379"
+	ClientPub = "f928d4f6c1b86c12f2562c10b07c555c5c57fd00f59e90c8d8d88767271cbf7c"
+
+	ServerIP = "192.168.4.29"
+	ClientIP = "192.168.4.28"
+)
+
+// Hello is the body of the server at http://ServerIP/
+const Hello = "Hello from userspace TCP!"
+
+var LogLevel = device.LogLevelError
+
+// ServerConfig is the uapi config of the server which allows the client peer, append lines for more peers
+const ServerConfig = `private_key=` + ServerKey + `
+listen_port=0
+public_key=` + ClientPub + `
+allowed_ip=` + ClientIP + `/32
+`
+
+// ClientConfig is the uapi config of the client which routes everything to the server at endpoint
+func ClientConfig(endpoint string) string {
+	return `private_key=` + ClientKey + `
+public_key=` + ServerPub + `
+allowed_ip=0.0.0.0/0
+endpoint=` + endpoint + `
+`
+}
+
+// StartServer starts the server peer with conf, it serves Hello at / and n zero bytes at /bytes?n=
+func StartServer(bind conn.Bind, conf string) (dev *device.Device, tnet *netstack.Net) {
+	dev, tnet = StartPeer(bind, "server ", ServerIP, conf)
+
+	listener := try.To1(tnet.ListenTCP(&net.TCPAddr{Port: 80}))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, Hello)
+	})
+	mux.HandleFunc("/bytes", func(writer http.ResponseWriter, request *http.Request) {
+		n := try.To1(strconv.Atoi(request.URL.Query().Get("n")))
+		io.Copy(writer, io.LimitReader(zeros{}, int64(n)))
+	})
+	go http.Serve(listener, mux)
+	return
+}
+
+// StartClient starts the client peer which talks to the server at endpoint
+func StartClient(bind conn.Bind, endpoint string) (dev *device.Device, tnet *netstack.Net) {
+	return StartPeer(bind, "client ", ClientIP, ClientConfig(endpoint))
+}
+
+// StartPeer starts a wireguard device at ip with conf
+func StartPeer(bind conn.Bind, name string, ip string, conf string) (dev *device.Device, tnet *netstack.Net) {
+	tdev, tnet, err := netstack.CreateNetTUN(
+		[]netip.Addr{netip.MustParseAddr(ip)},
+		[]netip.Addr{netip.MustParseAddr("8.8.8.8")},
+		1420,
+	)
+	try.To(err)
+	dev = device.NewDevice(tdev, bind, device.NewLogger(LogLevel, name))
+	try.To(dev.IpcSet(conf))
+	try.To(dev.Up())
+	return
+}
+
+// Get returns the body of path of the server through tnet
+func Get(tnet *netstack.Net, path string, timeout time.Duration) string {
+	resp := try.To1(client(tnet, timeout).Get("http://" + ServerIP + path))
+	defer resp.Body.Close()
+	return string(try.To1(io.ReadAll(resp.Body)))
+}
+
+// Download reads n bytes of the server through tnet, it returns the read size
+func Download(tnet *netstack.Net, n int, timeout time.Duration) int {
+	resp := try.To1(client(tnet, timeout).Get(fmt.Sprintf("http://%s/bytes?n=%d", ServerIP, n)))
+	defer resp.Body.Close()
+	return int(try.To1(io.Copy(io.Discard, resp.Body)))
+}
+
+func client(tnet *netstack.Net, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: tnet.DialContext,
+		},
+		Timeout: timeout,
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package loopback
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/signaler"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+type baseEndpoint struct {
+	id string
+}
+
+func (ep *baseEndpoint) DstToBytes() []byte  { return []byte(ep.id) }
+func (ep *baseEndpoint) DstToString() string { return "loopback/" + ep.id }
+func (*baseEndpoint) ClearSrc()              {}
+func (*baseEndpoint) SrcToString() string    { return "" }
+func (*baseEndpoint) DstIP() netip.Addr      { return netip.Addr{} }
+func (*baseEndpoint) SrcIP() netip.Addr      { return netip.Addr{} }
+
+type Outbound struct {
+	baseEndpoint
+	bind *Bind
+
+	pipe   *pipe
+	locker sync.Mutex
+}
+
+var (
+	_ conn.Endpoint   = (*Outbound)(nil)
+	_ endpoint.Sender = (*Outbound)(nil)
+)
+
+func (ep *Outbound) Send(buf []byte) (err error) {
+	ep.locker.Lock()
+	p := ep.pipe
+	ep.locker.Unlock()
+	if buf[0] == 1 {
+		// wireguard reuses buf once Send returns
+		buf = append([]byte(nil), buf...)
+		go ep.Connect(buf)
+		return
+	}
+	if p == nil {
+		return net.ErrClosed
+	}
+	write(p.outbound, buf)
+	return
+}
+
+func (ep *Outbound) Connect(buf []byte) (err error) {
+	p := ep.bind.newPipe()
+	defer func() {
+		if err != nil {
+			ep.bind.removePipe(p)
+		}
+	}()
+	offer, err := newSDP(p.id, webrtc.SDPTypeOffer, buf)
+	if err != nil {
+		return
+	}
+	answer, err := ep.bind.Handshake(ep.id, offer)
+	if err != nil {
+		return
+	}
+	if answer == nil {
+		return endpoint.ErrInitiatorResponderRequired
+	}
+	sd, err := answer.Unmarshal()
+	if err != nil {
+		return
+	}
+	responder, err := endpoint.Responder(sd)
+	if err != nil {
+		return
+	}
+	if responder == nil {
+		return endpoint.ErrInitiatorResponderRequired
+	}
+
+	ep.locker.Lock()
+	old := ep.pipe
+	ep.pipe = p
+	ep.locker.Unlock()
+	if old != nil {
+		ep.bind.removePipe(old)
+	}
+
+	ep.bind.deliver(responder, ep)
+	go ep.bind.forward(p, p.inbound, ep)
+	return
+}
+
+// Close removes the pipe, the peer sees it closed
+func (ep *Outbound) Close() error {
+	ep.locker.Lock()
+	p := ep.pipe
+	ep.pipe = nil
+	ep.locker.Unlock()
+	if p != nil {
+		ep.bind.removePipe(p)
+	}
+	return nil
+}
+
+type Inbound struct {
+	baseEndpoint
+	bind *Bind
+	sess signaler.Session
+
+	pipe     *pipe
+	resolved bool
+	locker   sync.Mutex
+}
+
+var (
+	_ conn.Endpoint   = (*Inbound)(nil)
+	_ endpoint.Sender = (*Inbound)(nil)
+)
+
+func (ep *Inbound) Send(buf []byte) (err error) {
+	ep.locker.Lock()
+	defer ep.locker.Unlock()
+	if !ep.resolved {
+		if buf[0] != 2 {
+			return net.ErrClosed
+		}
+		answer, err := newSDP(ep.pipe.id, webrtc.SDPTypeAnswer, buf)
+		if err != nil {
+			return err
+		}
+		if err = ep.sess.Resolve(&answer); err != nil {
+			return err
+		}
+		ep.resolved = true
+		go ep.bind.forward(ep.pipe, ep.pipe.outbound, ep)
+		return nil
+	}
+	write(ep.pipe.inbound, buf)
+	return
+}
+
+// Close removes the pipe, the peer sees it closed
+func (ep *Inbound) Close() error {
+	ep.bind.removePipe(ep.pipe)
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package loopback is a Bind which follows the wgortc signaler handshake
+// (initiator in offer, responder in answer) but moves packets over in-memory pipes,
+// so wireguard logic and signaler.Channel implementations could be unit tested quickly
+package loopback
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/signaler"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+type Bind struct {
+	signaler.Channel
+
+	msgCh chan packetMsg
+	done  chan struct{}
+	// pipes are created or joined by the endpoints, Close removes them
+	pipes map[*pipe]struct{}
+
+	locker *sync.RWMutex
+}
+
+var _ conn.Bind = (*Bind)(nil)
+
+func NewBind(signaler signaler.Channel) *Bind {
+	return &Bind{
+		Channel: signaler,
+
+		msgCh: make(chan packetMsg, 128),
+		done:  closedCh(),
+		pipes: map[*pipe]struct{}{},
+
+		locker: &sync.RWMutex{},
+	}
+}
+
+type packetMsg struct {
+	data []byte
+	ep   conn.Endpoint
+}
+
+func (b *Bind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	ch, err := b.Accept()
+	if err != nil {
+		return
+	}
+	go func() {
+		for sess := range ch {
+			go b.handleConnect(sess)
+		}
+	}()
+
+	b.done = make(chan struct{})
+	return []conn.ReceiveFunc{b.receiveFunc}, port, nil
+}
+
+func closedCh() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func (b *Bind) closed() <-chan struct{} {
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	return b.done
+}
+
+func (b *Bind) receiveFunc(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
+	select {
+	case msg := <-b.msgCh:
+		sizes[0] = copy(packets[0], msg.data)
+		eps[0] = msg.ep
+		return 1, nil
+	case <-b.closed():
+		return 0, net.ErrClosed
+	}
+}
+
+func (b *Bind) deliver(data []byte, ep conn.Endpoint) {
+	select {
+	case b.msgCh <- packetMsg{data: data, ep: ep}:
+	case <-b.closed():
+	}
+}
+
+// forward delivers packets from ch until pipe or bind is closed
+func (b *Bind) forward(p *pipe, ch <-chan []byte, ep conn.Endpoint) {
+	done := b.closed()
+	for {
+		select {
+		case data := <-ch:
+			b.deliver(data, ep)
+		case <-p.done:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+func (b *Bind) handleConnect(sess signaler.Session) {
+	offer := sess.Description()
+	sd, err := offer.Unmarshal()
+	if err != nil {
+		sess.Reject(err)
+		return
+	}
+	id, ok := sd.Attribute(pipeAttr)
+	if !ok {
+		sess.Reject(ErrNotLoopback)
+		return
+	}
+	p := findPipe(id)
+	if p == nil {
+		sess.Reject(ErrPipeNotFound)
+		return
+	}
+	b.addPipe(p)
+	initiator, err := endpoint.Initiator(sd)
+	if err != nil {
+		sess.Reject(err)
+		return
+	}
+	if initiator == nil {
+		sess.Reject(endpoint.ErrInitiatorRequired)
+		return
+	}
+	ep := &Inbound{
+		baseEndpoint: baseEndpoint{id: id},
+		bind:         b,
+		sess:         sess,
+		pipe:         p,
+	}
+	b.deliver(initiator, ep)
+}
+
+func (b *Bind) Close() (err error) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+	close(b.done)
+	for p := range b.pipes {
+		p.remove()
+	}
+	b.pipes = map[*pipe]struct{}{}
+	if b.Channel != nil {
+		err = b.Channel.Close()
+	}
+	return
+}
+
+func (b *Bind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	return &Outbound{
+		baseEndpoint: baseEndpoint{id: s},
+		bind:         b,
+	}, nil
+}
+
+func (b *Bind) Send(bufs [][]byte, ep conn.Endpoint) (err error) {
+	sender, ok := ep.(endpoint.Sender)
+	if !ok {
+		return conn.ErrWrongEndpointType
+	}
+	for _, buf := range bufs {
+		if err = sender.Send(buf); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (b *Bind) SetMark(mark uint32) error { return nil }
+func (b *Bind) BatchSize() int            { return 1 }
+
+var (
+	ErrNotLoopback  = errors.New("offer is not created by loopback bind")
+	ErrPipeNotFound = errors.New("loopback pipe is not found")
+)
+
+const pipeAttr = "wgortc-loopback"
+
+// pipe is shared by the two endpoints of a connection
+type pipe struct {
+	id       string
+	outbound chan []byte
+	inbound  chan []byte
+	done     chan struct{}
+	once     sync.Once
+}
+
+var (
+	pipes  = map[string]*pipe{}
+	pipesL sync.Mutex
+)
+
+func newPipe() *pipe {
+	b := make([]byte, 16)
+	rand.Read(b)
+	p := &pipe{
+		id:       hex.EncodeToString(b),
+		outbound: make(chan []byte, 128),
+		inbound:  make(chan []byte, 128),
+		done:     make(chan struct{}),
+	}
+	pipesL.Lock()
+	defer pipesL.Unlock()
+	pipes[p.id] = p
+	return p
+}
+
+func findPipe(id string) *pipe {
+	pipesL.Lock()
+	defer pipesL.Unlock()
+	return pipes[id]
+}
+
+func (b *Bind) newPipe() *pipe {
+	p := newPipe()
+	b.addPipe(p)
+	return p
+}
+
+func (b *Bind) addPipe(p *pipe) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	b.pipes[p] = struct{}{}
+}
+
+func (b *Bind) removePipe(p *pipe) {
+	b.locker.Lock()
+	delete(b.pipes, p)
+	b.locker.Unlock()
+	p.remove()
+}
+
+func (p *pipe) remove() {
+	pipesL.Lock()
+	defer pipesL.Unlock()
+	delete(pipes, p.id)
+	p.once.Do(func() { close(p.done) })
+}
+
+// write drops packet like udp when the pipe is full
+func write(ch chan []byte, buf []byte) {
+	select {
+	case ch <- append([]byte(nil), buf...):
+	default:
+	}
+}
+
+func newSDP(id string, typ webrtc.SDPType, msg []byte) (desc webrtc.SessionDescription, err error) {
+	sd := &sdp.SessionDescription{
+		Origin: sdp.Origin{
+			Username:       "-",
+			NetworkType:    "IN",
+			AddressType:    "IP4",
+			UnicastAddress: "127.0.0.1",
+		},
+		SessionName:      "wgortc",
+		TimeDescriptions: []sdp.TimeDescription{{}},
+		Attributes:       []sdp.Attribute{sdp.NewAttribute(pipeAttr, id)},
+	}
+	endpoint.SetMessage(sd, msg)
+	raw, err := sd.Marshal()
+	if err != nil {
+		return
+	}
+	return webrtc.SessionDescription{Type: typ, SDP: string(raw)}, nil
+}
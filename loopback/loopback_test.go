@@ -0,0 +1,36 @@
+package loopback_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/loopback"
+	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+func TestNet(t *testing.T) {
+	hub := local.NewHub()
+	dev := startServer(hub)
+	defer dev.Close()
+	dev2, tnet := startClient(hub)
+	defer dev2.Close()
+
+	assert.Equal(testutil.Get(tnet, "/", 5*time.Second), testutil.Hello)
+}
+
+func startServer(hub *local.Hub) (dev *device.Device) {
+	s := local.NewServer()
+	hub.Register("server", s)
+	dev, _ = testutil.StartServer(loopback.NewBind(s), testutil.ServerConfig)
+	return
+}
+
+func startClient(hub *local.Hub) (dev *device.Device, tnet *netstack.Net) {
+	s := local.NewServer()
+	hub.Register("client", s)
+	return testutil.StartClient(loopback.NewBind(s), "server")
+}
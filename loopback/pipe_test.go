@@ -0,0 +1,58 @@
+package loopback
+
+import (
+	"testing"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+func TestPipeRemoved(t *testing.T) {
+	hub := local.NewHub()
+	s1, s2 := local.NewServer(), local.NewServer()
+	hub.Register("server", s1)
+	hub.Register("client", s2)
+	server, client := NewBind(s1), NewBind(s2)
+	fns, _ := try.To2(server.Open(0))
+	defer server.Close()
+	try.To2(client.Open(0))
+	defer client.Close()
+
+	go answer(fns[0])
+	ep := try.To1(client.ParseEndpoint("server")).(*Outbound)
+	initiator := make([]byte, endpoint.MessageInitiationSize)
+	initiator[0] = endpoint.MessageInitiationType
+	try.To(ep.Connect(initiator))
+	assert.Equal(pipesLen(), 1)
+
+	// reconnecting replaces the pipe
+	go answer(fns[0])
+	try.To(ep.Connect(initiator))
+	assert.Equal(pipesLen(), 1)
+
+	try.To(client.Close())
+	assert.Equal(pipesLen(), 0)
+}
+
+// answer responds the first initiator received by fn
+func answer(fn conn.ReceiveFunc) {
+	packets, sizes, eps := [][]byte{make([]byte, 1500)}, []int{0}, []conn.Endpoint{nil}
+	for {
+		try.To1(fn(packets, sizes, eps))
+		if in, ok := eps[0].(*Inbound); ok && packets[0][0] == endpoint.MessageInitiationType {
+			responder := make([]byte, endpoint.MessageResponseSize)
+			responder[0] = endpoint.MessageResponseType
+			try.To(in.Send(responder))
+			return
+		}
+	}
+}
+
+func pipesLen() int {
+	pipesL.Lock()
+	defer pipesL.Unlock()
+	return len(pipes)
+}
@@ -0,0 +1,178 @@
+// Package netsim wires Binds through pion vnet routers,
+// so nat, packet loss and latency could be tested without real network
+package netsim
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/logging"
+	"github.com/pion/transport/v2/vnet"
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/signaler"
+	"github.com/shynome/wgortc/turnserver"
+)
+
+var (
+	FullCone = &vnet.NATType{
+		MappingBehavior:   vnet.EndpointIndependent,
+		FilteringBehavior: vnet.EndpointIndependent,
+	}
+	PortRestrictedCone = &vnet.NATType{
+		MappingBehavior:   vnet.EndpointIndependent,
+		FilteringBehavior: vnet.EndpointAddrPortDependent,
+	}
+	Symmetric = &vnet.NATType{
+		MappingBehavior:   vnet.EndpointAddrPortDependent,
+		FilteringBehavior: vnet.EndpointAddrPortDependent,
+	}
+)
+
+type Config struct {
+	// Loss is the percent of packets dropped on wan
+	Loss    int
+	Latency time.Duration
+	Jitter  time.Duration
+	// MTU drops wan packets larger than it, zero means no limit
+	MTU int
+}
+
+const (
+	turnIP     = "1.2.3.4"
+	turnSecret = "netsim"
+
+	ipv4Overhead = 20
+	udpOverhead  = 8
+)
+
+// Network is a wan with a STUN/TURN server, peers are attached to it directly or behind nat
+type Network struct {
+	wan  *vnet.Router
+	turn *turnserver.Server
+
+	peers int
+}
+
+func New(config Config) (n *Network, err error) {
+	n = &Network{}
+	n.wan, err = vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:      "1.2.3.0/24",
+		MinDelay:  config.Latency,
+		MaxJitter: config.Jitter,
+
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		return
+	}
+	if config.Loss > 0 {
+		var locker sync.Mutex
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		n.wan.AddChunkFilter(func(c vnet.Chunk) bool {
+			locker.Lock()
+			defer locker.Unlock()
+			return r.Intn(100) >= config.Loss
+		})
+	}
+
+	if config.MTU > 0 {
+		n.wan.AddChunkFilter(func(c vnet.Chunk) bool {
+			return len(c.UserData())+ipv4Overhead+udpOverhead <= config.MTU
+		})
+	}
+
+	tnet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{turnIP}})
+	if err != nil {
+		return
+	}
+	if err = n.wan.AddNet(tnet); err != nil {
+		return
+	}
+	n.turn, err = turnserver.Start(turnserver.Config{
+		Listen:       turnIP + ":3478",
+		RelayIP:      net.ParseIP(turnIP),
+		RelayAddress: turnIP,
+		Secret:       turnSecret,
+		Net:          tnet,
+	})
+	return
+}
+
+// NewBind creates a Bind which network is behind nat, nil nat means the Bind has a public ip on wan.
+// the STUN server of Network is used as default ICEServers
+func (n *Network) NewBind(s signaler.Channel, nat *vnet.NATType) (b *wgortc.Bind, err error) {
+	n.peers++
+	publicIP := fmt.Sprintf("1.2.3.%d", 10+n.peers)
+	var pnet *vnet.Net
+	if nat == nil {
+		if pnet, err = vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{publicIP}}); err != nil {
+			return
+		}
+		if err = n.wan.AddNet(pnet); err != nil {
+			return
+		}
+	} else {
+		lan, err := vnet.NewRouter(&vnet.RouterConfig{
+			CIDR:      fmt.Sprintf("10.0.%d.0/24", n.peers),
+			StaticIPs: []string{publicIP},
+			NATType:   nat,
+
+			LoggerFactory: logging.NewDefaultLoggerFactory(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = n.wan.AddRouter(lan); err != nil {
+			return nil, err
+		}
+		if pnet, err = vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{fmt.Sprintf("10.0.%d.2", n.peers)}}); err != nil {
+			return nil, err
+		}
+		if err = lan.AddNet(pnet); err != nil {
+			return nil, err
+		}
+	}
+
+	b = wgortc.NewBind(s)
+	b.Net = pnet
+	b.NewSettingEngine = func() (e webrtc.SettingEngine) {
+		e.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+		return
+	}
+	b.ICEServers = []webrtc.ICEServer{{URLs: []string{n.STUN()}}}
+	return b, nil
+}
+
+func (n *Network) STUN() string {
+	return "stun:" + turnIP + ":3478"
+}
+
+// TURN returns a TURN server with ephemeral credentials for user
+func (n *Network) TURN(user string) webrtc.ICEServer {
+	username, credential := turnserver.Credentials(turnSecret, user, time.Hour)
+	return webrtc.ICEServer{
+		URLs:       []string{"turn:" + turnIP + ":3478"},
+		Username:   username,
+		Credential: credential,
+	}
+}
+
+// Allocations is the count of TURN allocations
+func (n *Network) Allocations() int {
+	return n.turn.AllocationCount()
+}
+
+// Start starts routing, it should be called after all Binds are created
+func (n *Network) Start() error {
+	return n.wan.Start()
+}
+
+func (n *Network) Close() error {
+	n.turn.Close()
+	return n.wan.Stop()
+}
@@ -0,0 +1,234 @@
+package netsim_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/transport/v2/vnet"
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/netsim"
+	"github.com/shynome/wgortc/signaler"
+	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// hide signaler.Relay, so the tunnel works only if ice connects
+type noRelay struct{ signaler.Channel }
+
+func TestTunnel(t *testing.T) {
+	cases := []struct {
+		name   string
+		config netsim.Config
+		nat    [2]*vnet.NATType
+		turn   bool
+		// relay through signaler when ice fails
+		relay bool
+	}{
+		{name: "public"},
+		{name: "full-cone", nat: [2]*vnet.NATType{netsim.FullCone, netsim.FullCone}},
+		{name: "port-restricted", nat: [2]*vnet.NATType{netsim.PortRestrictedCone, netsim.PortRestrictedCone}},
+		{name: "symmetric-full-cone", nat: [2]*vnet.NATType{netsim.Symmetric, netsim.FullCone}},
+		{name: "symmetric", nat: [2]*vnet.NATType{netsim.Symmetric, netsim.Symmetric}, relay: true},
+		{name: "symmetric-turn", nat: [2]*vnet.NATType{netsim.Symmetric, netsim.Symmetric}, turn: true},
+		{name: "loss-latency", nat: [2]*vnet.NATType{netsim.FullCone, netsim.FullCone},
+			config: netsim.Config{Loss: 5, Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			n := try.To1(netsim.New(c.config))
+			defer n.Close()
+
+			hub := local.NewHub()
+			s1, s2 := local.NewServer(), local.NewServer()
+			hub.Register("server", s1)
+			hub.Register("client", s2)
+			var sig1, sig2 signaler.Channel = noRelay{s1}, noRelay{s2}
+			if c.relay {
+				sig1, sig2 = s1, s2
+			}
+			b1 := try.To1(n.NewBind(sig1, c.nat[0]))
+			b2 := try.To1(n.NewBind(sig2, c.nat[1]))
+			try.To(n.Start())
+
+			endpoint := "server"
+			if c.turn {
+				turn := n.TURN("client")
+				endpoint = fmt.Sprintf("webrtc://server?relay=force&ice=%s&username=%s&credential=%s",
+					turn.URLs[0], url.QueryEscape(turn.Username), url.QueryEscape(turn.Credential.(string)))
+			}
+
+			dev := startServer(b1)
+			defer dev.Close()
+			dev2, tnet := startClient(b2, endpoint)
+			defer dev2.Close()
+
+			assert.Equal(testutil.Get(tnet, "/", 30*time.Second), testutil.Hello)
+			if c.turn {
+				assert.NotZero(n.Allocations())
+			}
+		})
+	}
+}
+
+// inner udp datagrams are lost with unreliable DataChannels, reliable ones outlast several sctp retransmissions.
+// partial ones are between: pion fast retransmits a chunk once even if its lifetime is over,
+// so only the negotiated reliability and lifetime are checked
+func TestReliability(t *testing.T) {
+	const count = 200
+	cases := []struct {
+		reliability endpoint.Reliability
+		lifetime    time.Duration
+		// lost means some datagrams are lost, all means none is lost
+		lost, all bool
+		// idle is how long the receiver waits for the next datagram
+		idle time.Duration
+	}{
+		{reliability: endpoint.ReliabilityUnreliable, lost: true, idle: 2 * time.Second},
+		{reliability: endpoint.ReliabilityPartial, lifetime: 10 * time.Millisecond, idle: 2 * time.Second},
+		{reliability: endpoint.ReliabilityReliable, all: true, idle: 10 * time.Second},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.reliability.String(), func(t *testing.T) {
+			n := try.To1(netsim.New(netsim.Config{Loss: 10}))
+			defer n.Close()
+
+			hub := local.NewHub()
+			s1, s2 := local.NewServer(), local.NewServer()
+			hub.Register("server", s1)
+			hub.Register("client", s2)
+			b1 := try.To1(n.NewBind(noRelay{s1}, netsim.FullCone))
+			b2 := try.To1(n.NewBind(noRelay{s2}, netsim.FullCone))
+			try.To(n.Start())
+
+			server := &recordBind{Bind: b1, eps: make(chan conn.Endpoint, 1)}
+			dev, tnet1 := startServerNet(server)
+			defer dev.Close()
+			uri := "webrtc://server?reliability=" + c.reliability.String()
+			if c.lifetime != 0 {
+				uri += "&lifetime=" + c.lifetime.String()
+			}
+			dev2, tnet2 := startClient(b2, uri)
+			defer dev2.Close()
+
+			pc := try.To1(tnet1.ListenUDP(&net.UDPAddr{Port: 9}))
+			defer pc.Close()
+			pc.SetReadDeadline(time.Now().Add(60 * time.Second))
+			received := make(chan int)
+			go func() {
+				buf := make([]byte, 1500)
+				n := 0
+				for {
+					if _, err := pc.Read(buf); err != nil {
+						break
+					}
+					if n++; n == count {
+						break
+					}
+					pc.SetReadDeadline(time.Now().Add(c.idle))
+				}
+				received <- n
+			}()
+
+			testutil.Get(tnet2, "/", 30*time.Second)
+
+			// the inbound side applies what the offer negotiated
+			inbound := (<-server.eps).(*endpoint.Inbound)
+			assert.Equal(inbound.Reliability(), c.reliability)
+			assert.Equal(inbound.Options.Lifetime, c.lifetime)
+
+			conn := try.To1(tnet2.DialUDP(nil, &net.UDPAddr{IP: net.IPv4(192, 168, 4, 29), Port: 9}))
+			defer conn.Close()
+			for i := 0; i < count; i++ {
+				try.To1(conn.Write([]byte("hello")))
+				time.Sleep(5 * time.Millisecond)
+			}
+			got := <-received
+			switch {
+			case c.lost:
+				assert.That(got < count, "received %d", got)
+			case c.all:
+				assert.Equal(got, count)
+			}
+		})
+	}
+}
+
+// the wan drops packets larger than 1260, probes larger than 1260-20-8-37-28 are lost
+func TestMTUProbe(t *testing.T) {
+	n := try.To1(netsim.New(netsim.Config{MTU: 1260}))
+	defer n.Close()
+
+	hub := local.NewHub()
+	s1, s2 := local.NewServer(), local.NewServer()
+	hub.Register("server", s1)
+	hub.Register("client", s2)
+	b1 := try.To1(n.NewBind(noRelay{s1}, nil))
+	b2 := try.To1(n.NewBind(noRelay{s2}, nil))
+	try.To(n.Start())
+
+	server := &recordBind{Bind: b1, eps: make(chan conn.Endpoint, 1)}
+	dev, _ := startServerNet(server)
+	defer dev.Close()
+	dev2, tnet := startClient(b2, "server")
+	defer dev2.Close()
+
+	c := try.To1(tnet.DialUDP(nil, &net.UDPAddr{IP: net.IPv4(192, 168, 4, 29), Port: 9}))
+	defer c.Close()
+	try.To1(c.Write([]byte("hello")))
+	inbound := (<-server.eps).(*endpoint.Inbound)
+	assert.Equal(inbound.MTU(), endpoint.PathMTU(0, false, false))
+
+	const probed = 1200 - 3*16
+	for i := 0; i < 50 && inbound.MTU() != probed; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(inbound.MTU(), probed)
+}
+
+func startServer(bind *wgortc.Bind) (dev *device.Device) {
+	dev, _ = startServerNet(bind)
+	return
+}
+
+func startServerNet(bind conn.Bind) (dev *device.Device, tnet *netstack.Net) {
+	return testutil.StartServer(bind, testutil.ServerConfig)
+}
+
+func startClient(bind *wgortc.Bind, endpoint string) (dev *device.Device, tnet *netstack.Net) {
+	return testutil.StartClient(bind, endpoint)
+}
+
+// recordBind records the endpoint of the first received packet
+type recordBind struct {
+	*wgortc.Bind
+	eps chan conn.Endpoint
+}
+
+func (b *recordBind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	fns, actualPort, err = b.Bind.Open(port)
+	for i, fn := range fns {
+		fn := fn
+		fns[i] = func(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
+			n, err = fn(packets, sizes, eps)
+			for _, ep := range eps[:n] {
+				select {
+				case b.eps <- ep:
+				default:
+				}
+			}
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package wgortc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/transport/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/signaler"
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// Option configures the Bind created by New, it sets the exported field of the same name
+type Option func(b *Bind)
+
+// New creates a Bind like NewBind and applies opts, the result is validated up front
+func New(signaler signaler.Channel, opts ...Option) (*Bind, error) {
+	b := NewBind(signaler)
+	for _, opt := range opts {
+		opt(b)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+var ErrInvalidConfig = errors.New("invalid bind config")
+
+// Validate checks the settings of Bind, Open calls it too
+func (b *Bind) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+	}
+	if len(b.signalers()) == 0 {
+		return invalid("signaler is required")
+	}
+	for _, s := range b.ICEServers {
+		for _, u := range s.URLs {
+			if _, err := ice.ParseURL(u); err != nil {
+				return invalid("ice server %s: %v", u, err)
+			}
+		}
+	}
+	if b.Channels < 0 || b.Channels > endpoint.MaxChannels {
+		return invalid("channels %d", b.Channels)
+	}
+	if b.Lifetime != 0 && (b.Lifetime < time.Millisecond || b.Lifetime > math.MaxUint16*time.Millisecond) {
+		return invalid("lifetime %s", b.Lifetime)
+	}
+	if b.LinkMTU != 0 && (b.LinkMTU < endpoint.MinLinkMTU || b.LinkMTU > endpoint.MaxLinkMTU) {
+		return invalid("link mtu %d", b.LinkMTU)
+	}
+	if b.Cover != 0 && b.Cover < time.Millisecond {
+		return invalid("cover %s", b.Cover)
+	}
+	// unknown values have no name to parse
+	if _, err := endpoint.ParseReliability(b.Reliability.String()); err != nil {
+		return invalid("%v", err)
+	}
+	if _, err := endpoint.ParseTransport(b.Transport.String()); err != nil {
+		return invalid("%v", err)
+	}
+	if _, err := endpoint.ParsePadding(b.Padding.String()); err != nil {
+		return invalid("%v", err)
+	}
+	if err := b.Timeouts.Validate(); err != nil {
+		return invalid("%v", err)
+	}
+	if b.MaxInbounds < 0 {
+		return invalid("max inbounds %d", b.MaxInbounds)
+	}
+	if len(b.TrustedKeys) != 0 && b.PrivateKey.IsZero() {
+		return invalid("trusted keys require private key")
+	}
+	return nil
+}
+
+func (b *Bind) logf(format string, args ...any) {
+	if b.Logger != nil {
+		b.Logger.Verbosef(format, args...)
+	}
+}
+
+func WithSignalers(signalers map[string]signaler.Channel) Option {
+	return func(b *Bind) { b.Signalers = signalers }
+}
+
+func WithICEServers(servers ...webrtc.ICEServer) Option {
+	return func(b *Bind) { b.ICEServers = servers }
+}
+
+func WithICEServerProvider(p ICEServerProvider) Option {
+	return func(b *Bind) { b.ICEServerProvider = p }
+}
+
+func WithICETransportPolicy(policy webrtc.ICETransportPolicy) Option {
+	return func(b *Bind) { b.ICETransportPolicy = policy }
+}
+
+func WithCandidateTypes(types ...webrtc.ICECandidateType) Option {
+	return func(b *Bind) { b.CandidateTypes = types }
+}
+
+func WithNetworkTypes(types ...webrtc.NetworkType) Option {
+	return func(b *Bind) { b.NetworkTypes = types }
+}
+
+func WithSettingEngine(fn func() webrtc.SettingEngine) Option {
+	return func(b *Bind) { b.NewSettingEngine = fn }
+}
+
+func WithNet(n transport.Net) Option {
+	return func(b *Bind) { b.Net = n }
+}
+
+func WithTimeouts(t endpoint.Timeouts) Option {
+	return func(b *Bind) { b.Timeouts = t }
+}
+
+func WithLogger(logger *device.Logger) Option {
+	return func(b *Bind) { b.Logger = logger }
+}
+
+func WithMaxInbounds(n int) Option {
+	return func(b *Bind) { b.MaxInbounds = n }
+}
+
+func WithTransport(t endpoint.Transport) Option {
+	return func(b *Bind) { b.Transport = t }
+}
+
+func WithReliability(r endpoint.Reliability, lifetime time.Duration) Option {
+	return func(b *Bind) { b.Reliability, b.Lifetime = r, lifetime }
+}
+
+func WithChannels(n int) Option {
+	return func(b *Bind) { b.Channels = n }
+}
+
+func WithLinkMTU(mtu int, fragment bool) Option {
+	return func(b *Bind) { b.LinkMTU, b.Fragment = mtu, fragment }
+}
+
+func WithPadding(p endpoint.Padding, cover time.Duration) Option {
+	return func(b *Bind) { b.Padding, b.Cover = p, cover }
+}
+
+func WithCertificate(cert *webrtc.Certificate) Option {
+	return func(b *Bind) { b.Certificate = cert }
+}
+
+// WithIdentity binds the dtls identity to the wireguard key, see Bind.PrivateKey
+func WithIdentity(privateKey endpoint.Key, trustedKeys ...endpoint.Key) Option {
+	return func(b *Bind) { b.PrivateKey, b.TrustedKeys = privateKey, trustedKeys }
+}
+
+func WithCapabilities(caps ...endpoint.Capability) Option {
+	return func(b *Bind) { b.Capabilities = caps }
+}
@@ -0,0 +1,88 @@
+package wgortc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/pion/webrtc/v3"
+	"github.com/shynome/wgortc/endpoint"
+	"github.com/shynome/wgortc/signaler"
+	"github.com/shynome/wgortc/signaler/local"
+)
+
+func TestNew(t *testing.T) {
+	s := local.NewServer()
+	b := try.To1(New(s,
+		WithICEServers(webrtc.ICEServer{URLs: []string{"stun:127.0.0.1:3478"}}),
+		WithTimeouts(endpoint.Timeouts{DataChannel: time.Second}),
+		WithReliability(endpoint.ReliabilityPartial, 200*time.Millisecond),
+		WithTransport(endpoint.TransportRTP),
+		WithMaxInbounds(8),
+	))
+	assert.Equal[signaler.Channel](b.Channel, s)
+	assert.Equal(b.Lifetime, 200*time.Millisecond)
+	assert.Equal(b.Transport, endpoint.TransportRTP)
+	assert.Equal(b.MaxInbounds, 8)
+
+	opts := b.endpointOptions(endpoint.Options{})
+	assert.Equal(opts.Timeouts.DataChannel, time.Second)
+	assert.Equal(opts.Timeouts.Answer, endpoint.DefaultTimeouts.Answer)
+
+	for name, opts := range map[string][]Option{
+		"ice":          {WithICEServers(webrtc.ICEServer{URLs: []string{"http://127.0.0.1"}})},
+		"channels":     {WithChannels(endpoint.MaxChannels + 1)},
+		"lifetime":     {WithReliability(endpoint.ReliabilityPartial, time.Microsecond)},
+		"mtu":          {WithLinkMTU(1000, false)},
+		"cover":        {WithPadding(endpoint.PaddingRandom, time.Microsecond)},
+		"transport":    {WithTransport(endpoint.Transport(9))},
+		"timeouts":     {WithTimeouts(endpoint.Timeouts{Answer: -time.Second})},
+		"max inbounds": {WithMaxInbounds(-1)},
+		"trusted keys": {WithIdentity(endpoint.Key{}, endpoint.Key{1})},
+	} {
+		_, err := New(s, opts...)
+		assert.That(errors.Is(err, ErrInvalidConfig), name)
+	}
+	_, err := New(nil)
+	assert.That(errors.Is(err, ErrInvalidConfig))
+}
+
+func TestEndpointOptions(t *testing.T) {
+	b := NewBind(local.NewServer())
+	b.Reliability, b.Lifetime = endpoint.ReliabilityPartial, 200*time.Millisecond
+
+	ep := try.To1(b.ParseEndpoint("server")).(*endpoint.Outbound)
+	assert.Equal(ep.Options.Reliability, endpoint.ReliabilityPartial)
+	assert.Equal(ep.Options.Lifetime, 200*time.Millisecond)
+
+	ep = try.To1(b.ParseEndpoint("webrtc://server?reliability=unreliable")).(*endpoint.Outbound)
+	assert.Equal(ep.Options.Reliability, endpoint.ReliabilityUnreliable)
+	ep = try.To1(b.ParseEndpoint("webrtc://server?lifetime=50ms")).(*endpoint.Outbound)
+	assert.Equal(ep.Options.Reliability, endpoint.ReliabilityPartial)
+	assert.Equal(ep.Options.Lifetime, 50*time.Millisecond)
+
+	b.Fragment = true
+	ep = try.To1(b.ParseEndpoint("webrtc://server?fragment=false")).(*endpoint.Outbound)
+	assert.That(!ep.Options.Fragment)
+	ep = try.To1(b.ParseEndpoint("server")).(*endpoint.Outbound)
+	assert.That(ep.Options.Fragment)
+
+	b.Padding = endpoint.PaddingBucket
+	ep = try.To1(b.ParseEndpoint("webrtc://server?padding=none")).(*endpoint.Outbound)
+	assert.Equal(ep.Options.Padding, endpoint.PaddingNone)
+
+	b.Transport = endpoint.TransportRTP
+	ep = try.To1(b.ParseEndpoint("webrtc://server?transport=datachannel")).(*endpoint.Outbound)
+	assert.Equal(ep.Options.Transport, endpoint.TransportDataChannel)
+}
+
+func TestDefaultSignalerUnset(t *testing.T) {
+	b := try.To1(New(nil, WithSignalers(map[string]signaler.Channel{"ws": local.NewServer()})))
+	_, err := b.ParseEndpoint("server")
+	assert.That(errors.Is(err, ErrSignalerNotFound))
+	_, err = b.Signaler("")
+	assert.That(errors.Is(err, ErrSignalerNotFound))
+	try.To1(b.ParseEndpoint("webrtc://server?signaler=ws"))
+}
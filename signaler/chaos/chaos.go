@@ -0,0 +1,168 @@
+// Package chaos is a signaler.Channel decorator which injects signaling faults,
+// faults are driven by a seeded rng so tests are reproducible
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shynome/wgortc/signaler"
+)
+
+// Config rates are probabilities in [0, 1]
+type Config struct {
+	Seed int64
+
+	// Latency and Jitter delay every handshake
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// DropOffer makes Handshake fail with ErrDropped
+	DropOffer float64
+	// DuplicateSession delivers an accepted session twice
+	DuplicateSession float64
+	// ReorderAnswer holds the answer for ReorderDelay, so later answers overtake it
+	ReorderAnswer float64
+	ReorderDelay  time.Duration
+	// CorruptSDP flips a byte of offer or answer sdp
+	CorruptSDP float64
+	// Reject rejects an accepted session with ErrInjected
+	Reject float64
+}
+
+var (
+	ErrDropped  = errors.New("chaos: offer is dropped")
+	ErrInjected = errors.New("chaos: session is rejected")
+)
+
+// Channel hides the signaler.Relay capability of the wrapped channel
+type Channel struct {
+	signaler.Channel
+	config Config
+
+	rand  *rand.Rand
+	randL sync.Mutex
+
+	// done is closed by Close, so the forwarding of Accept doesn't block on a gone consumer
+	done  chan struct{}
+	doneL sync.Mutex
+}
+
+var _ signaler.Channel = (*Channel)(nil)
+
+func New(ch signaler.Channel, config Config) *Channel {
+	if config.ReorderDelay == 0 {
+		config.ReorderDelay = 2*(config.Latency+config.Jitter) + 100*time.Millisecond
+	}
+	return &Channel{
+		Channel: ch,
+		config:  config,
+		rand:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+func (c *Channel) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.randL.Lock()
+	defer c.randL.Unlock()
+	return c.rand.Float64() < rate
+}
+
+func (c *Channel) intn(n int) int {
+	c.randL.Lock()
+	defer c.randL.Unlock()
+	return c.rand.Intn(n)
+}
+
+func (c *Channel) delay() {
+	d := c.config.Latency
+	if j := c.config.Jitter; j > 0 {
+		d += time.Duration(c.intn(int(j)))
+	}
+	time.Sleep(d)
+}
+
+func (c *Channel) corrupt(sdp signaler.SDP) signaler.SDP {
+	if len(sdp.SDP) == 0 {
+		return sdp
+	}
+	b := []byte(sdp.SDP)
+	i := c.intn(len(b))
+	b[i] ^= byte(1 + c.intn(255))
+	sdp.SDP = string(b)
+	return sdp
+}
+
+func (c *Channel) Handshake(endpoint string, offer signaler.SDP) (answer *signaler.SDP, err error) {
+	c.delay()
+	if c.roll(c.config.DropOffer) {
+		return nil, ErrDropped
+	}
+	if c.roll(c.config.CorruptSDP) {
+		offer = c.corrupt(offer)
+	}
+	answer, err = c.Channel.Handshake(endpoint, offer)
+	if err != nil {
+		return
+	}
+	if answer != nil && c.roll(c.config.CorruptSDP) {
+		corrupted := c.corrupt(*answer)
+		answer = &corrupted
+	}
+	if c.roll(c.config.ReorderAnswer) {
+		time.Sleep(c.config.ReorderDelay)
+	}
+	return
+}
+
+func (c *Channel) Accept() (offerCh <-chan signaler.Session, err error) {
+	ch, err := c.Channel.Accept()
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	c.doneL.Lock()
+	c.done = done
+	c.doneL.Unlock()
+	out := make(chan signaler.Session)
+	forward := func(sess signaler.Session) bool {
+		select {
+		case out <- sess:
+			return true
+		case <-done:
+			sess.Reject(net.ErrClosed)
+			return false
+		}
+	}
+	go func() {
+		defer close(out)
+		for sess := range ch {
+			if c.roll(c.config.Reject) {
+				sess.Reject(ErrInjected)
+				continue
+			}
+			if !forward(sess) {
+				return
+			}
+			if c.roll(c.config.DuplicateSession) && !forward(sess) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (c *Channel) Close() error {
+	c.doneL.Lock()
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+	c.doneL.Unlock()
+	return c.Channel.Close()
+}
@@ -0,0 +1,107 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/signaler"
+	"github.com/shynome/wgortc/signaler/chaos"
+	"github.com/shynome/wgortc/signaler/local"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+func TestReconnect(t *testing.T) {
+	cases := []struct {
+		name   string
+		client chaos.Config
+		server chaos.Config
+	}{
+		{name: "latency", client: chaos.Config{Latency: 200 * time.Millisecond, Jitter: 100 * time.Millisecond}},
+		{name: "drop-offer", client: chaos.Config{Seed: 1, DropOffer: 0.5}},
+		{name: "duplicate-session", server: chaos.Config{DuplicateSession: 1}},
+		{name: "reorder-answer", client: chaos.Config{Seed: 1, ReorderAnswer: 0.5}},
+		{name: "corrupt-sdp", client: chaos.Config{Seed: 1, CorruptSDP: 0.3}},
+		{name: "reject", server: chaos.Config{Seed: 1, Reject: 0.5}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			hub := local.NewHub()
+			dev := startServer(hub, c.server)
+			defer dev.Close()
+			dev2, tnet := startClient(hub, c.client)
+			assert.Equal(httpGet(tnet, 30*time.Second), testutil.Hello)
+
+			// the client restarts, the server should replace the stale session
+			dev2.Close()
+			dev2, tnet = startClient(hub, c.client)
+			defer dev2.Close()
+			assert.Equal(httpGet(tnet, 30*time.Second), testutil.Hello)
+		})
+	}
+}
+
+func TestServerRestart(t *testing.T) {
+	config := chaos.Config{Seed: 3, DropOffer: 0.3, Latency: 50 * time.Millisecond}
+	hub := local.NewHub()
+	dev := startServer(hub, config)
+	dev2, tnet := startClient(hub, config)
+	defer dev2.Close()
+	assert.Equal(httpGet(tnet, 30*time.Second), testutil.Hello)
+
+	// the client retries handshake after it stops hearing back for 15 seconds,
+	// then tcp retransmits syn at 31 seconds
+	dev.Close()
+	dev = startServer(hub, config)
+	defer dev.Close()
+	assert.Equal(httpGet(tnet, 45*time.Second), testutil.Hello)
+}
+
+func httpGet(tnet *netstack.Net, timeout time.Duration) string {
+	return testutil.Get(tnet, "/", timeout)
+}
+
+func startServer(hub *local.Hub, config chaos.Config) (dev *device.Device) {
+	s := local.NewServer()
+	hub.Register("server", s)
+	dev, _ = testutil.StartServer(wgortc.NewBind(chaos.New(s, config)), testutil.ServerConfig)
+	return
+}
+
+func startClient(hub *local.Hub, config chaos.Config) (dev *device.Device, tnet *netstack.Net) {
+	s := local.NewServer()
+	hub.Register("client", s)
+	return testutil.StartClient(wgortc.NewBind(chaos.New(s, config)), "server")
+}
+
+// acceptChannel delivers sessions of ch, it isn't closed by Close like a slow signaler
+type acceptChannel struct {
+	signaler.Channel
+	ch chan signaler.Session
+}
+
+func (c *acceptChannel) Accept() (<-chan signaler.Session, error) { return c.ch, nil }
+func (c *acceptChannel) Close() error                             { return nil }
+
+func TestAcceptClose(t *testing.T) {
+	inner := &acceptChannel{ch: make(chan signaler.Session)}
+	c := chaos.New(inner, chaos.Config{})
+	out := try.To1(c.Accept())
+	try.To(c.Close())
+
+	// nobody reads out after Close, the session is rejected instead of blocking forever
+	sess := local.NewSession(context.Background(), signaler.SDP{})
+	inner.ch <- sess
+	_, err := sess.Result()
+	assert.That(errors.Is(err, net.ErrClosed))
+	_, ok := <-out
+	assert.That(!ok)
+}
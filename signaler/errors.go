@@ -0,0 +1,11 @@
+package signaler
+
+import "errors"
+
+// errors of Channel, peers may come online later so callers could retry them
+var (
+	// ErrPeerNotFound means no peer is registered under the endpoint name
+	ErrPeerNotFound = errors.New("peer is not found")
+	// ErrPeerNotReady means the peer doesn't accept sessions or relayed packets yet
+	ErrPeerNotReady = errors.New("peer is not ready")
+)
@@ -2,6 +2,7 @@ package local
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,24 +13,33 @@ import (
 type Server struct {
 	ch  chan signaler.Session
 	hub *Hub
+
+	name    string
+	relayCh chan signaler.Packet
+	relayL  sync.RWMutex
 }
 
 func NewServer() *Server {
 	return &Server{}
 }
 
-var _ signaler.Channel = (*Server)(nil)
+var ErrNotRegistered = errors.New("server need register to a local hub")
+
+var (
+	_ signaler.Channel = (*Server)(nil)
+	_ signaler.Relay   = (*Server)(nil)
+)
 
 func (s *Server) Handshake(endpoint string, offer signaler.SDP) (answer *signaler.SDP, err error) {
 	if s.hub == nil {
-		return nil, fmt.Errorf("server need register to a local hub")
+		return nil, ErrNotRegistered
 	}
 	remote := s.hub.Find(endpoint)
 	if remote == nil {
-		return nil, fmt.Errorf("server is not found. ep: %s", endpoint)
+		return nil, fmt.Errorf("%w: %s", signaler.ErrPeerNotFound, endpoint)
 	}
 	if remote.ch == nil {
-		return nil, fmt.Errorf("server is not ready accept")
+		return nil, fmt.Errorf("%w: %s doesn't accept", signaler.ErrPeerNotReady, endpoint)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -86,11 +96,53 @@ func (s *Server) Accept() (ch <-chan signaler.Session, err error) {
 	return
 }
 
+func (s *Server) Relay(endpoint string, packet []byte) (err error) {
+	if s.hub == nil {
+		return ErrNotRegistered
+	}
+	remote := s.hub.Find(endpoint)
+	if remote == nil {
+		return fmt.Errorf("%w: %s", signaler.ErrPeerNotFound, endpoint)
+	}
+	// Close may run concurrently, the lock keeps relayCh open while sending
+	remote.relayL.RLock()
+	defer remote.relayL.RUnlock()
+	if remote.relayCh == nil {
+		return fmt.Errorf("%w: %s doesn't relay", signaler.ErrPeerNotReady, endpoint)
+	}
+	p := signaler.Packet{
+		From: s.name,
+		Data: append([]byte(nil), packet...),
+	}
+	select {
+	case remote.relayCh <- p:
+	default: // drop like udp
+	}
+	return
+}
+
+func (s *Server) Relayed() (ch <-chan signaler.Packet, err error) {
+	s.relayL.Lock()
+	defer s.relayL.Unlock()
+	if s.relayCh != nil {
+		return s.relayCh, nil
+	}
+	s.relayCh = make(chan signaler.Packet, 128)
+	ch = s.relayCh
+	return
+}
+
 func (s *Server) Close() (err error) {
 	if ch := s.ch; ch != nil {
 		s.ch = nil
 		close(ch)
 	}
+	s.relayL.Lock()
+	defer s.relayL.Unlock()
+	if ch := s.relayCh; ch != nil {
+		s.relayCh = nil
+		close(ch)
+	}
 	return
 }
 
@@ -113,6 +165,7 @@ func (hub *Hub) Register(endpoint string, server *Server) {
 	hub.poolL.Lock()
 	defer hub.poolL.Unlock()
 	server.hub = hub
+	server.name = endpoint
 	hub.pool[endpoint] = server
 }
 
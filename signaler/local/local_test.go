@@ -2,6 +2,7 @@ package local
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/lainio/err2/assert"
@@ -34,3 +35,44 @@ func TestChannel(t *testing.T) {
 	assert.Equal(answer.Type, webrtc.SDPTypeAnswer)
 
 }
+
+func TestRelay(t *testing.T) {
+	var hub = NewHub()
+	s1, s2 := NewServer(), NewServer()
+	hub.Register("s1", s1)
+	hub.Register("s2", s2)
+
+	ch := try.To1(s1.Relayed())
+	packet := []byte{4, 0, 0, 0}
+	try.To(s2.Relay("s1", packet))
+	packet[0] = 1 // relay must not retain packet
+
+	p := <-ch
+	assert.Equal(p.From, "s2")
+	assert.DeepEqual(p.Data, []byte{4, 0, 0, 0})
+
+	err := s1.Relay("s2", packet)
+	assert.That(errors.Is(err, signaler.ErrPeerNotReady), "s2 is not ready relay")
+	err = s1.Relay("s3", packet)
+	assert.That(errors.Is(err, signaler.ErrPeerNotFound))
+	_, err = NewServer().Handshake("s1", signaler.SDP{})
+	assert.That(errors.Is(err, ErrNotRegistered))
+}
+
+func TestRelayClose(t *testing.T) {
+	var hub = NewHub()
+	s1, s2 := NewServer(), NewServer()
+	hub.Register("s1", s1)
+	hub.Register("s2", s2)
+	try.To1(s1.Relayed())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			s2.Relay("s1", []byte{4, 0, 0, 0})
+		}
+	}()
+	try.To(s1.Close())
+	<-done
+}
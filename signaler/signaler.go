@@ -16,3 +16,17 @@ type Session interface {
 	Resolve(answer *SDP) (err error)
 	Reject(err error)
 }
+
+// Relay is an optional capability of Channel.
+// it relays wireguard packets over the signaling transport when ice can't connect
+type Relay interface {
+	// Relay must not retain packet after return
+	Relay(endpoint string, packet []byte) (err error)
+	Relayed() (ch <-chan Packet, err error)
+}
+
+type Packet struct {
+	// From is the endpoint name of sender
+	From string
+	Data []byte
+}
@@ -0,0 +1,28 @@
+// Package turnrest implements the TURN REST API ephemeral credentials with a shared secret,
+// it is shared by the TURN server and the clients without pulling the server in
+package turnrest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// Credentials generates ephemeral credentials, which expire after ttl.
+// username is `expires:user`, password is base64(hmac-sha1(secret, username))
+func Credentials(secret string, user string, ttl time.Duration) (username, credential string) {
+	username = strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	return username, Password(secret, username)
+}
+
+// Password is the credential of username
+func Password(secret string, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,22 @@
+package turnrest
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	username, credential := Credentials("secret", "client", time.Minute)
+	expires, user, _ := strings.Cut(username, ":")
+	assert.Equal(user, "client")
+	ts, err := strconv.ParseInt(expires, 10, 64)
+	assert.NoError(err)
+	assert.That(ts > time.Now().Unix())
+	assert.Equal(credential, Password("secret", username))
+	// echo -n 1700000000:client | openssl dgst -sha1 -hmac secret -binary | base64
+	assert.Equal(Password("secret", "1700000000:client"), "IOShA4EAjj+4UpYnUVrFrb/xJgo=")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/shynome/wgortc/turnserver"
+)
+
+type users map[string]string
+
+func (u users) String() string { return "" }
+func (u users) Set(s string) error {
+	name, password, _ := strings.Cut(s, "=")
+	u[name] = password
+	return nil
+}
+
+func main() {
+	var (
+		config  turnserver.Config
+		relayIP string
+	)
+	config.Users = users{}
+	flag.StringVar(&config.Listen, "listen", ":3478", "udp address to listen")
+	flag.StringVar(&relayIP, "relay-ip", "", "ip announced in relay candidates, usually the public ip")
+	flag.StringVar(&config.RelayAddress, "relay-address", "0.0.0.0", "local address relays are allocated on")
+	flag.StringVar(&config.Realm, "realm", "wgortc", "realm")
+	flag.Var(users(config.Users), "user", "long-term credential `username=password`, can be repeated")
+	flag.StringVar(&config.Secret, "secret", os.Getenv("TURN_SECRET"), "shared secret of TURN REST API ephemeral credentials")
+	flag.Parse()
+
+	config.RelayIP = net.ParseIP(relayIP)
+	s, err := turnserver.Start(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	log.Printf("turn server is listening on %s", s.Addr())
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	<-ch
+}
@@ -0,0 +1,112 @@
+package turnserver
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v2"
+	"github.com/pion/transport/v2/stdnet"
+	"github.com/pion/turn/v2"
+	"github.com/shynome/wgortc/turnrest"
+)
+
+type Config struct {
+	// Listen is the udp address to listen, default is ":3478"
+	Listen string
+	// RelayIP is the ip announced in relay candidates, usually the public ip
+	RelayIP net.IP
+	// RelayAddress is the local address relays are allocated on, default is "0.0.0.0"
+	RelayAddress string
+
+	Realm string
+	// Users are long-term credentials, username => password
+	Users map[string]string
+	// Secret enables TURN REST API ephemeral credentials, see Credentials
+	Secret string
+
+	// Net replaces the network stack, such as pion vnet
+	Net transport.Net
+
+	LoggerFactory logging.LoggerFactory
+}
+
+type Server struct {
+	*turn.Server
+	config Config
+	conn   net.PacketConn
+}
+
+var ErrRelayIPRequired = errors.New("turnserver: RelayIP is required")
+
+func Start(config Config) (s *Server, err error) {
+	if config.RelayIP == nil {
+		return nil, ErrRelayIPRequired
+	}
+	if config.Listen == "" {
+		config.Listen = ":3478"
+	}
+	if config.RelayAddress == "" {
+		config.RelayAddress = "0.0.0.0"
+	}
+	if config.Realm == "" {
+		config.Realm = "wgortc"
+	}
+
+	if config.Net == nil {
+		if config.Net, err = stdnet.NewNet(); err != nil {
+			return nil, err
+		}
+	}
+
+	s = &Server{config: config}
+	if s.conn, err = config.Net.ListenPacket("udp", config.Listen); err != nil {
+		return nil, err
+	}
+	s.Server, err = turn.NewServer(turn.ServerConfig{
+		Realm:         config.Realm,
+		AuthHandler:   s.auth,
+		LoggerFactory: config.LoggerFactory,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: s.conn,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: config.RelayIP,
+					Address:      config.RelayAddress,
+					Net:          config.Net,
+				},
+			},
+		},
+	})
+	if err != nil {
+		s.conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Addr is the listened udp address
+func (s *Server) Addr() net.Addr { return s.conn.LocalAddr() }
+
+func (s *Server) auth(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	if password, ok := s.config.Users[username]; ok {
+		return turn.GenerateAuthKey(username, realm, password), true
+	}
+	if s.config.Secret == "" {
+		return nil, false
+	}
+	expires, _, _ := strings.Cut(username, ":")
+	t, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > t {
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, turnrest.Password(s.config.Secret, username)), true
+}
+
+// Credentials generates TURN REST API ephemeral credentials, which expire after ttl, see turnrest.Credentials
+func Credentials(secret string, user string, ttl time.Duration) (username, credential string) {
+	return turnrest.Credentials(secret, user, ttl)
+}
@@ -0,0 +1,59 @@
+package turnserver_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lainio/err2/assert"
+	"github.com/lainio/err2/try"
+	"github.com/shynome/wgortc"
+	"github.com/shynome/wgortc/internal/testutil"
+	"github.com/shynome/wgortc/signaler"
+	"github.com/shynome/wgortc/signaler/local"
+	"github.com/shynome/wgortc/turnserver"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+func TestRelayOnly(t *testing.T) {
+	const secret = "wgortc"
+	s := try.To1(turnserver.Start(turnserver.Config{
+		Listen:       "127.0.0.1:0",
+		RelayIP:      net.IPv4(127, 0, 0, 1),
+		RelayAddress: "127.0.0.1",
+		Secret:       secret,
+	}))
+	defer s.Close()
+
+	hub := local.NewHub()
+	dev := startServer(hub)
+	defer dev.Close()
+
+	username, credential := turnserver.Credentials(secret, "client", time.Minute)
+	ep := fmt.Sprintf("webrtc://server?relay=force&ice=turn:%s&username=%s&credential=%s",
+		s.Addr(), url.QueryEscape(username), url.QueryEscape(credential))
+	dev2, tnet := startClient(hub, ep)
+	defer dev2.Close()
+
+	assert.Equal(testutil.Get(tnet, "/", 10*time.Second), testutil.Hello)
+	assert.NotZero(s.AllocationCount())
+}
+
+// hide signaler.Relay, so the tunnel works only if ice connects through turn
+type noRelay struct{ signaler.Channel }
+
+func startServer(hub *local.Hub) (dev *device.Device) {
+	s := local.NewServer()
+	hub.Register("server", s)
+	dev, _ = testutil.StartServer(wgortc.NewBind(noRelay{s}), testutil.ServerConfig)
+	return
+}
+
+func startClient(hub *local.Hub, endpoint string) (dev *device.Device, tnet *netstack.Net) {
+	s := local.NewServer()
+	hub.Register("client", s)
+	return testutil.StartClient(wgortc.NewBind(noRelay{s}), endpoint)
+}